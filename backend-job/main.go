@@ -17,19 +17,165 @@ limitations under the License.
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
 	"strings"
+	"time"
 
+	"dprosper/calculator/internal/archive"
 	"dprosper/calculator/internal/logger"
+	"dprosper/calculator/internal/objectstore"
 	"dprosper/calculator/internal/updater"
+	"dprosper/calculator/internal/watch"
+	"dprosper/calculator/internal/webhook"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
+// defaultWebhooksLog is the delivery log of the webhooks, relative to the
+// backend-job directory.
+const defaultWebhooksLog = "logs/webhooks.jsonl"
+
+// defaultWatchedCidrs is the registry of our own CIDRs checked against each new
+// data set, relative to the backend-job directory.
+const defaultWatchedCidrs = "watched-cidrs.json"
+
+// Exit codes, so a scheduler only opens a pull request when the ranges changed.
+const (
+	exitChanged   = 0
+	exitFailed    = 1
+	exitUnchanged = 3
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "rollback" {
+		rollback(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "notify" {
+		notifyWebhooks(os.Args[2:])
+		return
+	}
 
-	logger.InitLogger(false, true, true)
+	source := flag.String("source", "", "ips.md source: an http(s) URL, a file path or git:<checkout>[:<path>][@<revision>], defaults to the source config value or the IBM Cloud docs")
+	offline := flag.Bool("offline", false, "rebuild the data set from the vendored snapshot "+updater.SnapshotPath)
+	saveSnapshot := flag.Bool("save-snapshot", false, "replace the vendored snapshot with the fetched ips.md")
+	force := flag.Bool("force", false, "rebuild the data set even when ips.md and the metadata did not change")
+	dryRun := flag.Bool("dry-run", false, "fetch, parse, validate and diff, print what would change and write nothing")
+	allowMissingMetadata := flag.Bool("allow-missing-metadata", false, "publish data centers that have no city or geo region in "+updater.MetadataPath)
+	flag.Parse()
+
+	if *dryRun {
+		logger.InitConsoleLogger()
+	} else {
+		logger.InitLogger(false, true, true)
+	}
+
+	// A dry run publishes nothing, so it does not need the object storage
+	// credentials of cos.json.
+	readConfig(!*dryRun)
+
+	sourceSpec := *source
+	if sourceSpec == "" {
+		sourceSpec = viper.GetString("source")
+	}
+	if sourceSpec == "" {
+		sourceSpec = updater.DefaultSourceURL
+	}
+	if *offline {
+		snapshot, err := updater.LoadSnapshot()
+		if err != nil {
+			logger.ErrorLogger.Fatal("offline mode needs the vendored snapshot.", zap.String("error: ", err.Error()))
+		}
+		logger.SystemLogger.Info("rebuilding from the vendored snapshot",
+			zap.String("source", snapshot.Source),
+			zap.String("revision", snapshot.Revision),
+		)
+		sourceSpec = updater.SnapshotPath
+	}
+
+	ipsSource, err := updater.ParseSource(sourceSpec)
+	if err != nil {
+		logger.ErrorLogger.Fatal("invalid ips.md source.", zap.String("error: ", err.Error()))
+	}
+
+	logger.SystemLogger.Info("ips.md source used",
+		zap.String("source", ipsSource.String()),
+	)
+
+	watched, err := watchedRegistry()
+	if err != nil {
+		logger.ErrorLogger.Fatal("invalid watched CIDRs.", zap.String("error: ", err.Error()))
+	}
+
+	options := updater.UpdateOptions{
+		Source:               ipsSource,
+		SaveSnapshot:         *saveSnapshot && !*offline,
+		Force:                *force,
+		Retention:            archive.DefaultRetention,
+		Watched:              watched,
+		AllowMissingMetadata: *allowMissingMetadata,
+		NoPrivateNetworks:    viper.GetStringSlice("validation.no_private_networks"),
+	}
 
+	if *dryRun {
+		os.Exit(planUpdate(options))
+	}
+
+	if viper.IsSet("retention.keep_last") {
+		options.Retention.KeepLast = viper.GetInt("retention.keep_last")
+	}
+	if viper.IsSet("retention.max_age_days") {
+		options.Retention.MaxAge = time.Duration(viper.GetInt("retention.max_age_days")) * 24 * time.Hour
+	}
+
+	if viper.GetString("bucket") != "" {
+		store, err := objectstore.NewClient(objectstore.Config{
+			Endpoint:        viper.GetString("endpoint"),
+			Region:          viper.GetString("region"),
+			Bucket:          viper.GetString("bucket"),
+			AccessKeyID:     viper.GetString("cos_hmac_keys.access_key_id"),
+			SecretAccessKey: viper.GetString("cos_hmac_keys.secret_access_key"),
+			PathStyle:       viper.GetBool("path_style"),
+		})
+		if err != nil {
+			logger.ErrorLogger.Fatal("invalid object storage configuration.", zap.String("error: ", err.Error()))
+		}
+		options.Store = store
+
+		logger.SystemLogger.Info("publishing to object storage",
+			zap.String("endpoint", viper.GetString("endpoint")),
+			zap.String("bucket", store.Bucket()),
+		)
+	} else {
+		logger.SystemLogger.Info("no bucket configured, the data set is not published to object storage.")
+	}
+
+	dispatcher, err := webhookDispatcher()
+	if err != nil {
+		logger.ErrorLogger.Fatal("invalid webhook configuration.", zap.String("error: ", err.Error()))
+	}
+	if dispatcher != nil {
+		options.Notifiers = append(options.Notifiers, dispatcher)
+	}
+
+	changed, err := updater.UpdateIPRanges(options)
+	if err != nil {
+		logger.ErrorLogger.Error("update failed.", zap.String("error: ", err.Error()))
+		os.Exit(exitFailed)
+	}
+
+	if !changed {
+		os.Exit(exitUnchanged)
+	}
+}
+
+// readConfig reads cos.json, environment variables override its values. When
+// required is false a missing cos.json is skipped and only the environment
+// variables are used.
+func readConfig(required bool) {
 	viper.SetConfigType("json")
 	viper.AddConfigPath("$HOME")
 	viper.AddConfigPath(".")
@@ -40,14 +186,170 @@ func main() {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
 	err := viper.ReadInConfig()
+	if _, notFound := err.(viper.ConfigFileNotFoundError); notFound && !required {
+		logger.SystemLogger.Info("no cos.json found, using the environment only.")
+		return
+	}
 	if err != nil {
-		logger.ErrorLogger.Fatal("Data file not found in all search paths, expecting cos.json in $HOME, . or ./local.")
+		logger.ErrorLogger.Fatal("Data file not found in all search paths, expecting cos.json in $HOME, . or ./local.", zap.String("error: ", err.Error()))
 	}
 
 	logger.SystemLogger.Info("Data file used",
 		zap.String("name", viper.GetString("resource_instance_id")),
 	)
+}
 
-	updater.UpdateIPRanges()
+// webhookDispatcher returns the dispatcher of the webhooks in the config, nil
+// when there are none.
+func webhookDispatcher() (*webhook.Dispatcher, error) {
+	var subscribers []webhook.Subscriber
+	if err := viper.UnmarshalKey("webhooks", &subscribers); err != nil {
+		return nil, err
+	}
+	if len(subscribers) == 0 {
+		return nil, nil
+	}
 
+	logPath := viper.GetString("webhooks_log")
+	if logPath == "" {
+		logPath = defaultWebhooksLog
+	}
+	return webhook.NewDispatcher(subscribers, logPath)
+}
+
+// watchedRegistry reads the watched CIDRs from the watched_cidrs path, or from
+// defaultWatchedCidrs when it exists.
+func watchedRegistry() (watch.Registry, error) {
+	path := viper.GetString("watched_cidrs")
+	if path == "" {
+		if _, err := os.Stat(defaultWatchedCidrs); err != nil {
+			return watch.Registry{}, nil
+		}
+		path = defaultWatchedCidrs
+	}
+
+	registry, err := watch.LoadRegistry(path)
+	if err != nil {
+		return registry, err
+	}
+
+	logger.SystemLogger.Info("watching CIDRs",
+		zap.String("path", path),
+		zap.Int("count", len(registry.Watched)),
+	)
+	return registry, nil
+}
+
+// notifyWebhooks sends the diff between two data sets to the configured
+// webhooks, e.g. to try a subscriber against a local receiver.
+func notifyWebhooks(args []string) {
+	flags := flag.NewFlagSet("notify", flag.ExitOnError)
+	from := flags.String("from", "", "path to the previous data set")
+	to := flags.String("to", updater.DatasetPath, "path to the current data set")
+	version := flags.String("version", archive.NewVersionID(time.Now()), "version sent with the event")
+	flags.Parse(args)
+
+	logger.InitLogger(false, true, true)
+	readConfig(true)
+
+	if *from == "" {
+		logger.ErrorLogger.Fatal("-from is required.")
+	}
+
+	dispatcher, err := webhookDispatcher()
+	if err != nil {
+		logger.ErrorLogger.Fatal("invalid webhook configuration.", zap.String("error: ", err.Error()))
+	}
+	if dispatcher == nil {
+		logger.ErrorLogger.Fatal("no webhooks configured.")
+	}
+
+	previous, err := updater.LoadIPRanges(*from)
+	if err != nil {
+		logger.ErrorLogger.Fatal("error reading the previous data set.", zap.String("error: ", err.Error()))
+	}
+	current, err := updater.LoadIPRanges(*to)
+	if err != nil {
+		logger.ErrorLogger.Fatal("error reading the current data set.", zap.String("error: ", err.Error()))
+	}
+
+	watched, err := watchedRegistry()
+	if err != nil {
+		logger.ErrorLogger.Fatal("invalid watched CIDRs.", zap.String("error: ", err.Error()))
+	}
+
+	err = dispatcher.Notify(updater.ReleaseEvent{
+		Event:       updater.EventPublished,
+		Version:     *version,
+		LastUpdated: current.LastUpdated,
+		Diff:        updater.DiffIPRanges(previous, current),
+		NewConflicts: watch.NewConflicts(
+			watch.FindConflicts(watched, previous.DataCenters),
+			watch.FindConflicts(watched, current.DataCenters),
+		),
+	})
+	if err != nil {
+		logger.ErrorLogger.Error("notify failed.", zap.String("error: ", err.Error()))
+		os.Exit(exitFailed)
+	}
+}
+
+// planUpdate prints what an update with options would publish and returns the
+// exit code the update would have.
+func planUpdate(options updater.UpdateOptions) int {
+	plan, err := updater.PlanUpdate(options)
+	if err != nil {
+		logger.ErrorLogger.Error("dry run failed.", zap.String("error: ", err.Error()))
+		return exitFailed
+	}
+
+	fmt.Println("Dry run, nothing is written.")
+	if err := plan.WriteSummary(os.Stdout); err != nil {
+		logger.ErrorLogger.Error("error writing the summary.", zap.String("error: ", err.Error()))
+		return exitFailed
+	}
+
+	switch {
+	case plan.Validation.Err() != nil:
+		return exitFailed
+	case !plan.Changed():
+		return exitUnchanged
+	default:
+		return exitChanged
+	}
+}
+
+// rollback restores a version of the archive in ../data/versions as the published data set.
+func rollback(args []string) {
+	flags := flag.NewFlagSet("rollback", flag.ExitOnError)
+	version := flags.String("version", "", "archived version to restore, defaults to the version before the current one")
+	list := flags.Bool("list", false, "list the versions that can be restored")
+	flags.Parse(args)
+
+	logger.InitLogger(false, true, true)
+
+	if *list {
+		versions, err := updater.ListVersions()
+		if err != nil {
+			logger.ErrorLogger.Fatal("error listing versions.", zap.String("error: ", err.Error()))
+		}
+		for _, v := range versions {
+			marker := " "
+			if v.Current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, v.ID)
+		}
+		return
+	}
+
+	restored, err := updater.Rollback(*version)
+	if err != nil {
+		logger.ErrorLogger.Fatal("rollback failed.", zap.String("error: ", err.Error()))
+	}
+
+	logger.SystemLogger.Info("data set rolled back.",
+		zap.String("version", restored.ID),
+		zap.String("path", updater.DatasetPath),
+	)
 }
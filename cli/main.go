@@ -0,0 +1,325 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	"dprosper/calculator/internal/archive"
+	"dprosper/calculator/internal/logger"
+	"dprosper/calculator/internal/network"
+	"dprosper/calculator/internal/subnetcalc"
+	"dprosper/calculator/internal/updater"
+	"dprosper/calculator/internal/watch"
+)
+
+const usage = `Usage: cli <command> [flags]
+
+Commands:
+  report    Check a CIDR against the IBM Cloud IP ranges and render a conflict report
+  index     Sync a search index with the published data set or a directory of network files
+  diff      Compare two versions of the data set
+  validate  Check a data set before it is published
+  versions  List the archived data set versions or print a file of one
+  watch     Check our watched CIDRs against the data set, per owner
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "report":
+		err = runReport(os.Args[2:])
+	case "index":
+		err = runIndex(os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "validate":
+		err = runValidate(os.Args[2:])
+	case "versions":
+		err = runVersions(os.Args[2:])
+	case "watch":
+		err = runWatch(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func runReport(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	dataFile := flags.String("data", "data/datacenters.json", "path to the published data set")
+	cidr := flags.String("cidr", "", "CIDR to check, e.g. 10.0.0.0/16")
+	dataCenters := flags.String("dc", "", "comma separated list of data centers to check, all when empty")
+	format := flags.String("format", "markdown", "report format: markdown, text, html or json")
+	output := flags.String("o", "", "write the report to a file instead of stdout")
+	excludeClosing := flags.Bool("exclude-closing", false, "leave out data centers that are closing or closed")
+	flags.Parse(args)
+
+	if _, err := netip.ParsePrefix(*cidr); err != nil {
+		return fmt.Errorf("a valid -cidr is required: %w", err)
+	}
+
+	reportFormat, err := subnetcalc.ParseReportFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	dataset, err := subnetcalc.LoadConfig(*dataFile)
+	if err != nil {
+		return fmt.Errorf("error reading data set %s: %w", *dataFile, err)
+	}
+
+	var selectedDataCenters []string
+	if *dataCenters != "" {
+		for _, dataCenter := range strings.Split(*dataCenters, ",") {
+			selectedDataCenters = append(selectedDataCenters, strings.ToLower(strings.TrimSpace(dataCenter)))
+		}
+	}
+
+	if *excludeClosing {
+		dataset.DataCenters = subnetcalc.ExcludeClosing(dataset.DataCenters)
+	}
+
+	requestedCidrNetwork, dataCentersOutput := subnetcalc.CalculateConflicts(dataset.DataCenters, *cidr, selectedDataCenters)
+
+	dataset.RequestedCidr = *cidr
+	dataset.RequestedCidrNetwork = requestedCidrNetwork
+	dataset.DataCenters = dataCentersOutput
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return subnetcalc.NewReport(dataset).Render(w, reportFormat)
+}
+
+func runIndex(args []string) error {
+	flags := flag.NewFlagSet("index", flag.ExitOnError)
+	indexPath := flags.String("index", "index", "path of the search index")
+	dataFile := flags.String("data", "data/datacenters.json", "path to the published data set")
+	sourcePath := flags.String("source", "", "index the per-network JSON files of this directory instead of the data set")
+	flags.Parse(args)
+
+	logger.InitLogger(false, true, true)
+
+	indexer := network.NewIndexer(*indexPath, "network")
+	indexer.Progress = func(progress network.IndexProgress) {
+		fmt.Fprintf(os.Stderr, "indexed %d/%d\n", progress.Processed, progress.Total)
+	}
+
+	var stats network.IndexStats
+	var err error
+	if *sourcePath != "" {
+		stats, err = indexer.IndexDirectory(context.Background(), *sourcePath)
+	} else {
+		stats, err = indexer.IndexDataCenters(context.Background(), *dataFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("added: %d, updated: %d, deleted: %d, unchanged: %d in %s\n", stats.Added, stats.Updated, stats.Deleted, stats.Unchanged, stats.Duration)
+	return nil
+}
+
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	fromFile := flags.String("from", "", "path to the previous data set")
+	toFile := flags.String("to", "data/datacenters.json", "path to the current data set")
+	format := flags.String("format", "json", "output format: json or markdown, the changelog entry for docs/history.md")
+	flags.Parse(args)
+
+	if *fromFile == "" {
+		return fmt.Errorf("-from is required")
+	}
+
+	previous, err := updater.LoadIPRanges(*fromFile)
+	if err != nil {
+		return fmt.Errorf("error reading data set %s: %w", *fromFile, err)
+	}
+
+	current, err := updater.LoadIPRanges(*toFile)
+	if err != nil {
+		return fmt.Errorf("error reading data set %s: %w", *toFile, err)
+	}
+
+	diff := updater.DiffIPRanges(previous, current)
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	case "markdown", "md":
+		changelog, err := diff.Changelog()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Print(changelog)
+		return err
+	default:
+		return fmt.Errorf("unknown format %q, expected json or markdown", *format)
+	}
+}
+
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	dataFile := flags.String("data", "data/datacenters.json", "path to the data set to check")
+	previousFile := flags.String("previous", "", "path to the published data set the counts are compared with")
+	maxDrop := flags.Float64("max-drop", updater.DefaultValidationOptions.MaxCountDrop, "fraction by which counts may drop from the previous data set")
+	allowMissingMetadata := flags.Bool("allow-missing-metadata", false, "accept data centers without a city or geo region")
+	noPrivateNetworks := flags.String("no-private-networks", "", "comma separated data centers accepted without private networks")
+	flags.Parse(args)
+
+	current, err := updater.LoadIPRanges(*dataFile)
+	if err != nil {
+		return fmt.Errorf("error reading data set %s: %w", *dataFile, err)
+	}
+
+	var previous updater.ICIPRanges
+	if *previousFile != "" {
+		previous, err = updater.LoadIPRanges(*previousFile)
+		if err != nil {
+			return fmt.Errorf("error reading data set %s: %w", *previousFile, err)
+		}
+	}
+
+	options := updater.DefaultValidationOptions
+	options.MaxCountDrop = *maxDrop
+	options.AllowMissingMetadata = *allowMissingMetadata
+	if *noPrivateNetworks != "" {
+		options.NoPrivateNetworks = strings.Split(strings.ToLower(*noPrivateNetworks), ",")
+	}
+
+	report := updater.ValidateIPRanges(current, previous, options)
+	for _, failure := range report.Failures {
+		fmt.Println(failure)
+	}
+	if len(report.Failures) > 0 {
+		return fmt.Errorf("%d validation failure(s)", len(report.Failures))
+	}
+
+	fmt.Println("no validation failures")
+	return nil
+}
+
+func runWatch(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	registryFile := flags.String("registry", "backend-job/watched-cidrs.json", "path to the watched CIDRs")
+	dataFile := flags.String("data", "data/datacenters.json", "path to the data set to check")
+	previousFile := flags.String("previous", "", "only report conflicts that are not in this data set")
+	owner := flags.String("owner", "", "only report the conflicts of this owner")
+	flags.Parse(args)
+
+	registry, err := watch.LoadRegistry(*registryFile)
+	if err != nil {
+		return err
+	}
+
+	current, err := updater.LoadIPRanges(*dataFile)
+	if err != nil {
+		return fmt.Errorf("error reading data set %s: %w", *dataFile, err)
+	}
+	conflicts := watch.FindConflicts(registry, current.DataCenters)
+
+	if *previousFile != "" {
+		previous, err := updater.LoadIPRanges(*previousFile)
+		if err != nil {
+			return fmt.Errorf("error reading data set %s: %w", *previousFile, err)
+		}
+		conflicts = watch.NewConflicts(watch.FindConflicts(registry, previous.DataCenters), conflicts)
+	}
+
+	if *owner != "" {
+		conflicts = watch.FilterOwners(conflicts, []string{*owner})
+	}
+
+	for _, conflict := range conflicts {
+		fmt.Println(conflict)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%d conflict(s) with watched CIDRs", len(conflicts))
+	}
+
+	fmt.Println("no conflicts with watched CIDRs")
+	return nil
+}
+
+// shortHash returns the first 12 characters of hash, all of it when shorter,
+// e.g. a manifest entry written without a hash.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func runVersions(args []string) error {
+	flags := flag.NewFlagSet("versions", flag.ExitOnError)
+	root := flags.String("archive", "data/versions", "path of the archive")
+	get := flags.String("get", "", "version to print a file of, latest for the newest one")
+	file := flags.String("file", archive.DatasetFile, "file of the version to print: datacenters.json, ips.md, changes.json or changes.md")
+	output := flags.String("o", "", "write the file to a path instead of stdout")
+	flags.Parse(args)
+
+	a := archive.Open(*root)
+
+	if *get == "" {
+		manifest, err := a.Manifest()
+		if err != nil {
+			return err
+		}
+		for _, version := range manifest.Versions {
+			fmt.Printf("%s  %s  %-12s %s\n", version.ID, version.PublishedAt.Format("2006-01-02 15:04:05"), version.LastUpdated, shortHash(version.SHA256))
+		}
+		return nil
+	}
+
+	data, err := a.ReadFile(*get, *file)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		return os.WriteFile(*output, data, 0644)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
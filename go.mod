@@ -3,8 +3,6 @@ module dprosper/calculator
 go 1.17
 
 require (
-	github.com/IBM/ibm-cos-sdk-go v1.9.0
-	github.com/Jeffail/gabs/v2 v2.6.1
 	github.com/blugelabs/bluge v0.1.9
 	github.com/fsnotify/fsnotify v1.5.1
 	github.com/gin-contrib/static v0.0.1
@@ -40,7 +38,6 @@ require (
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/golang/snappy v0.0.1 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
-	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/magiconair/properties v1.8.5 // indirect
@@ -0,0 +1,263 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"dprosper/calculator/internal/util"
+)
+
+// File names of a version. Only the data set is required.
+const (
+	DatasetFile   = "datacenters.json"
+	SourceFile    = "ips.md"
+	DiffFile      = "changes.json"
+	ChangelogFile = "changes.md"
+	ManifestFile  = "manifest.json"
+)
+
+var versionIDPattern = regexp.MustCompile(`^[0-9]{8}\.[0-9]{6}$`)
+
+// Version is an archived data set, as listed in the manifest.
+type Version struct {
+	ID          string            `json:"id"`
+	PublishedAt time.Time         `json:"published_at"`
+	LastUpdated string            `json:"last_updated,omitempty"`
+	Source      string            `json:"source,omitempty"`
+	SHA256      string            `json:"sha256"`
+	Files       map[string]string `json:"files"`
+}
+
+// Manifest lists the archived versions, oldest first.
+type Manifest struct {
+	Versions []Version `json:"versions"`
+}
+
+// Retention decides which versions Prune removes. The KeepLast newest versions
+// are always kept, older ones are removed once they are older than MaxAge. A
+// zero MaxAge removes every version beyond KeepLast, a zero KeepLast only
+// applies MaxAge.
+type Retention struct {
+	KeepLast int
+	MaxAge   time.Duration
+}
+
+// DefaultRetention is used by the backend job.
+var DefaultRetention = Retention{KeepLast: 30, MaxAge: 180 * 24 * time.Hour}
+
+// Archive stores each published version under <root>/<id>/ with a manifest in
+// <root>/manifest.json.
+type Archive struct {
+	Root string
+	now  func() time.Time
+}
+
+// Open returns the archive in root, which is created on the first Add.
+func Open(root string) *Archive {
+	return &Archive{Root: root, now: time.Now}
+}
+
+// NewVersionID returns the id of a version published at t.
+func NewVersionID(t time.Time) string {
+	return t.Format("20060102.150405")
+}
+
+// Add stores files as version id. files must hold DatasetFile. The files are
+// written before the manifest, so a listed version is always complete.
+func (a *Archive) Add(id string, source string, lastUpdated string, files map[string][]byte) (Version, error) {
+	if !versionIDPattern.MatchString(id) {
+		return Version{}, fmt.Errorf("invalid version id %q", id)
+	}
+	dataset, ok := files[DatasetFile]
+	if !ok {
+		return Version{}, fmt.Errorf("version %s has no %s", id, DatasetFile)
+	}
+
+	manifest, err := a.Manifest()
+	if err != nil {
+		return Version{}, err
+	}
+	for _, version := range manifest.Versions {
+		if version.ID == id {
+			return Version{}, fmt.Errorf("version %s already exists", id)
+		}
+	}
+
+	dir := filepath.Join(a.Root, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Version{}, err
+	}
+
+	version := Version{
+		ID:          id,
+		PublishedAt: a.now().UTC(),
+		LastUpdated: lastUpdated,
+		Source:      source,
+		SHA256:      util.SHA256(dataset),
+		Files:       map[string]string{},
+	}
+
+	for name, data := range files {
+		if filepath.Base(name) != name {
+			return Version{}, fmt.Errorf("invalid file name %q", name)
+		}
+		if err := util.WriteFileAtomic(filepath.Join(dir, name), data, 0644); err != nil {
+			return Version{}, err
+		}
+		version.Files[name] = util.SHA256(data)
+	}
+
+	manifest.Versions = append(manifest.Versions, version)
+	sort.Slice(manifest.Versions, func(i, j int) bool {
+		return manifest.Versions[i].ID < manifest.Versions[j].ID
+	})
+
+	return version, a.writeManifest(manifest)
+}
+
+// Manifest reads the manifest, an archive that does not exist yet is empty.
+func (a *Archive) Manifest() (Manifest, error) {
+	manifest := Manifest{Versions: []Version{}}
+
+	data, err := os.ReadFile(filepath.Join(a.Root, ManifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("error parsing %s: %w", filepath.Join(a.Root, ManifestFile), err)
+	}
+	return manifest, nil
+}
+
+func (a *Archive) writeManifest(manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(filepath.Join(a.Root, ManifestFile), data, 0644)
+}
+
+// Get returns version id, "latest" is the newest version.
+func (a *Archive) Get(id string) (Version, error) {
+	manifest, err := a.Manifest()
+	if err != nil {
+		return Version{}, err
+	}
+
+	if id == "latest" && len(manifest.Versions) > 0 {
+		return manifest.Versions[len(manifest.Versions)-1], nil
+	}
+	for _, version := range manifest.Versions {
+		if version.ID == id {
+			return version, nil
+		}
+	}
+	return Version{}, fmt.Errorf("version %s not found", id)
+}
+
+// ReadFile returns a file of version id and checks it against the manifest hash.
+func (a *Archive) ReadFile(id string, name string) ([]byte, error) {
+	version, err := a.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, ok := version.Files[name]
+	if !ok {
+		return nil, fmt.Errorf("version %s has no file %s", version.ID, name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(a.Root, version.ID, name))
+	if err != nil {
+		return nil, err
+	}
+	if util.SHA256(data) != hash {
+		return nil, fmt.Errorf("file %s of version %s does not match its hash in the manifest", name, version.ID)
+	}
+	return data, nil
+}
+
+// Find returns the version whose data set has the given hash.
+func (a *Archive) Find(sha256 string) (Version, bool, error) {
+	manifest, err := a.Manifest()
+	if err != nil {
+		return Version{}, false, err
+	}
+
+	for i := len(manifest.Versions) - 1; i >= 0; i-- {
+		if manifest.Versions[i].SHA256 == sha256 {
+			return manifest.Versions[i], true, nil
+		}
+	}
+	return Version{}, false, nil
+}
+
+// Prune removes the versions the retention policy no longer keeps, except the
+// ids in keep such as the published version. It returns the removed versions.
+func (a *Archive) Prune(retention Retention, keep ...string) ([]Version, error) {
+	manifest, err := a.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	protected := map[string]bool{}
+	for _, id := range keep {
+		protected[id] = true
+	}
+
+	cutoff := a.now().UTC().Add(-retention.MaxAge)
+	count := len(manifest.Versions)
+
+	var kept []Version
+	var removed []Version
+	for i, version := range manifest.Versions {
+		newest := count-i <= retention.KeepLast
+		expired := retention.MaxAge == 0 || version.PublishedAt.Before(cutoff)
+		if newest || protected[version.ID] || !expired {
+			kept = append(kept, version)
+			continue
+		}
+		removed = append(removed, version)
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	manifest.Versions = append([]Version{}, kept...)
+	if err := a.writeManifest(manifest); err != nil {
+		return nil, err
+	}
+
+	for _, version := range removed {
+		if err := os.RemoveAll(filepath.Join(a.Root, version.ID)); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"net/http"
+	"strings"
+
+	"dprosper/calculator/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// VersionsHandler serves the manifest of the archive in root.
+func VersionsHandler(root string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		manifest, err := Open(root).Manifest()
+		if err != nil {
+			logger.ErrorLogger.Error("error reading archive manifest", zap.String("root", root), zap.String("error: ", err.Error()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Versions are not available."})
+			return
+		}
+
+		c.JSON(http.StatusOK, manifest)
+	}
+}
+
+// VersionHandler serves a file of the version in the version path parameter,
+// "latest" for the newest one. The file query parameter selects the file and
+// defaults to the data set.
+func VersionHandler(root string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("version")
+		name := c.DefaultQuery("file", DatasetFile)
+
+		a := Open(root)
+		version, err := a.Get(id)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		if _, ok := version.Files[name]; !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "Version " + version.ID + " has no file " + name + "."})
+			return
+		}
+
+		data, err := a.ReadFile(version.ID, name)
+		if err != nil {
+			logger.ErrorLogger.Error("error reading archived file", zap.String("version", version.ID), zap.String("file", name), zap.String("error: ", err.Error()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Version file is not available."})
+			return
+		}
+
+		c.Header("X-Dataset-Version", version.ID)
+		c.Header("X-Content-Sha256", version.Files[name])
+		c.Data(http.StatusOK, contentType(name), data)
+	}
+}
+
+func contentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".json"):
+		return "application/json"
+	case strings.HasSuffix(name, ".md"):
+		return "text/markdown; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -71,6 +71,17 @@ func InitLogger(accessLog bool, systemLog bool, errorLog bool) zap.AtomicLevel {
 	return atomicLevel
 }
 
+// InitConsoleLogger sets up the system and error loggers without log files.
+// Both write to stderr, so stdout only carries the output of the command.
+func InitConsoleLogger() zap.AtomicLevel {
+	atomicLevel := zap.NewAtomicLevel()
+
+	SystemLogger = zap.New(zapcore.NewCore(getFileEncoder(), zapcore.Lock(os.Stderr), atomicLevel), zap.AddCaller())
+	ErrorLogger = zap.New(zapcore.NewCore(getFileEncoder(), zapcore.Lock(os.Stderr), atomicLevel), zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel))
+
+	return atomicLevel
+}
+
 func getFileEncoder() zapcore.Encoder {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -0,0 +1,155 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/search"
+	"github.com/blugelabs/bluge/search/aggregations"
+	"github.com/gin-gonic/gin"
+)
+
+const maxFacetSize = 100
+
+// facetFields are the keyword fields that can be counted and filtered on.
+var facetFields = []string{"data_center", "geo_region", "country", "service"}
+
+// facetLabels are the fields counted for each facet field, they keep the value
+// as published. The facet fields themselves are lowercased, like the filters.
+var facetLabels = map[string]string{
+	"data_center": "data_center",
+	"geo_region":  "geo_region_label",
+	"country":     "country_label",
+	"service":     "service_label",
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count uint64 `json:"count"`
+}
+
+// SearchFilters narrows a search. Values of the same field are OR'ed, fields are AND'ed.
+type SearchFilters struct {
+	DataCenters []string
+	GeoRegions  []string
+	Countries   []string
+	Services    []string
+	SubnetBits  []int
+}
+
+func (f SearchFilters) apply(query bluge.Query) bluge.Query {
+	filtered := bluge.NewBooleanQuery().AddMust(query)
+	empty := true
+
+	terms := map[string][]string{
+		"data_center": lower(f.DataCenters),
+		"geo_region":  lower(f.GeoRegions),
+		"country":     lower(f.Countries),
+		"service":     lower(f.Services),
+	}
+
+	for _, field := range facetFields {
+		values := terms[field]
+		if len(values) == 0 {
+			continue
+		}
+
+		anyOf := bluge.NewBooleanQuery().SetMinShould(1)
+		for _, value := range values {
+			anyOf.AddShould(bluge.NewTermQuery(value).SetField(field))
+		}
+		filtered.AddMust(anyOf)
+		empty = false
+	}
+
+	if len(f.SubnetBits) > 0 {
+		anyOf := bluge.NewBooleanQuery().SetMinShould(1)
+		for _, bits := range f.SubnetBits {
+			anyOf.AddShould(bluge.NewNumericRangeInclusiveQuery(float64(bits), float64(bits), true, true).SetField("subnet_bits"))
+		}
+		filtered.AddMust(anyOf)
+		empty = false
+	}
+
+	if empty {
+		return query
+	}
+	return filtered
+}
+
+func addFacetAggregations(request *bluge.TopNSearch) {
+	for _, field := range facetFields {
+		request.AddAggregation(field, aggregations.NewTermsAggregation(search.Field(facetLabels[field]), maxFacetSize))
+	}
+}
+
+func facetCounts(bucket *search.Bucket) map[string][]FacetCount {
+	facets := map[string][]FacetCount{}
+	for _, field := range facetFields {
+		counts := []FacetCount{}
+		for _, b := range bucket.Buckets(field) {
+			counts = append(counts, FacetCount{Value: b.Name(), Count: b.Count()})
+		}
+		facets[field] = counts
+	}
+	return facets
+}
+
+// filtersFromRequest reads the filters from repeated or comma separated query parameters.
+func filtersFromRequest(c *gin.Context) (SearchFilters, error) {
+	filters := SearchFilters{
+		DataCenters: queryValues(c, "data_center"),
+		GeoRegions:  queryValues(c, "geo_region"),
+		Countries:   queryValues(c, "country"),
+		Services:    queryValues(c, "service"),
+	}
+
+	for _, value := range queryValues(c, "subnet_bits") {
+		bits, err := strconv.Atoi(strings.TrimPrefix(value, "/"))
+		if err != nil || bits < 0 || bits > 32 {
+			return SearchFilters{}, fmt.Errorf("subnet_bits must be between 0 and 32, got %q", value)
+		}
+		filters.SubnetBits = append(filters.SubnetBits, bits)
+	}
+
+	return filters, nil
+}
+
+func queryValues(c *gin.Context, key string) []string {
+	var values []string
+	for _, param := range c.QueryArray(key) {
+		for _, value := range strings.Split(param, ",") {
+			value = strings.TrimSpace(value)
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func lower(values []string) []string {
+	lowered := make([]string, 0, len(values))
+	for _, value := range values {
+		lowered = append(lowered, strings.ToLower(value))
+	}
+	return lowered
+}
@@ -17,13 +17,15 @@ limitations under the License.
 package network
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/netip"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/blugelabs/bluge"
 	"go.uber.org/zap"
@@ -33,7 +35,13 @@ import (
 
 type Network struct {
 	ID                  string  `json:"-"`
-	Type                string  `jbroadcast_addressson:"type"`
+	Type                string  `json:"type"`
+	DataCenter          string  `json:"data_center,omitempty"`
+	Service             string  `json:"service,omitempty"`
+	Pod                 string  `json:"pod,omitempty"`
+	City                string  `json:"city,omitempty"`
+	Country             string  `json:"country,omitempty"`
+	GeoRegion           string  `json:"geo_region,omitempty"`
 	CidrNotations       string  `json:"cidr_notation"`
 	SubnetBits          float64 `json:"subnet_bits"`
 	SubnetMask          string  `json:"subnet_mask,omitempty"`
@@ -50,87 +58,21 @@ type Indexable interface {
 	Document([]byte) *bluge.Document
 }
 
-func Index(indexPath string, indexType string, sourcePath string) {
-	kwfType := bluge.NewKeywordField("_type", indexType).StoreValue().Aggregatable()
-	defaultCfg := bluge.DefaultConfig(indexPath).WithVirtualField(kwfType)
-
-	writer, err := bluge.OpenWriter(defaultCfg)
-	if err != nil {
-		logger.ErrorLogger.Fatal("error opening index", zap.String("index_path", indexPath), zap.String("error: ", err.Error()))
-	}
+// Index syncs the per-network JSON files in sourcePath into the index in the background.
+// The returned channel receives the outcome once indexing completes.
+func Index(indexPath string, indexType string, sourcePath string) <-chan IndexResult {
+	done := make(chan IndexResult, 1)
 
 	go func() {
-		err := indexData(writer, indexType, sourcePath)
+		stats, err := NewIndexer(indexPath, indexType).IndexDirectory(context.Background(), sourcePath)
 		if err != nil {
-			logger.ErrorLogger.Fatal("error indexing data", zap.String("index_type", indexType), zap.String("source_path", sourcePath), zap.String("error: ", err.Error()))
+			logger.ErrorLogger.Error("error indexing data", zap.String("index_type", indexType), zap.String("source_path", sourcePath), zap.String("error: ", err.Error()))
 		}
-		writer.Close()
+		done <- IndexResult{Stats: stats, Err: err}
+		close(done)
 	}()
-}
-
-func parseAndBuildDoc(indexType string, dir, filename string) (Indexable, *bluge.Document, error) {
-	obj, jsonBytes, err := parseJSONPath(indexType, dir, filename)
-	if err != nil {
-		return nil, nil, fmt.Errorf("error parsing JSON '%s': %w", filename, err)
-	}
-	doc := obj.Document(jsonBytes)
-	return obj, doc, nil
-}
-
-func indexData(writer *bluge.Writer, indexType string, sourcePath string) error {
-	logger.SystemLogger.Debug("Indexing started.")
-
-	startTime := time.Now()
-	dirEntries, err := ioutil.ReadDir(sourcePath)
-	if err != nil {
-		return err
-	}
-
-	var indexedCount int
-	var docs []*bluge.Document
-	for _, dirEntry := range dirEntries {
-		_, doc, err := parseAndBuildDoc(indexType, sourcePath, dirEntry.Name())
-		if err != nil {
-			return err
-		}
-
-		docs = append(docs, doc)
 
-		if len(docs) > 1000 {
-			err = indexBatch(writer, docs)
-			if err != nil {
-				return fmt.Errorf("error executing batch: %w", err)
-			}
-			indexedCount += len(docs)
-			docs = docs[:0]
-		}
-	}
-
-	if len(docs) > 0 {
-		err = indexBatch(writer, docs)
-		if err != nil {
-			return fmt.Errorf("error executing batch: %w", err)
-		}
-		indexedCount += len(docs)
-	}
-
-	indexTime := time.Since(startTime)
-	timePerDoc := float64(indexTime) / float64(indexedCount)
-	logger.SystemLogger.Debug("Indexing completed.",
-		zap.Int("docs_indexed", indexedCount),
-		zap.Duration("index_time", indexTime),
-		zap.Float64("doc_average_ms", timePerDoc/float64(time.Millisecond)),
-	)
-
-	return nil
-}
-
-func indexBatch(indexWriter *bluge.Writer, docs []*bluge.Document) error {
-	batch := bluge.NewBatch()
-	for _, doc := range docs {
-		batch.Update(doc.ID(), doc)
-	}
-	return indexWriter.Batch(batch)
+	return done
 }
 
 func parseJSONPath(indexType string, dir, filename string) (Indexable, []byte, error) {
@@ -161,6 +103,8 @@ func NewNetwork(id string) *Network {
 	}
 }
 
+// Document maps the network to its index fields. Bump mappingVersion when the
+// mapping changes.
 func (b *Network) Document(jsonBytes []byte) *bluge.Document {
 	cidrAddress := strings.Split(b.CidrNotations, "/")[0]
 	cidrBits, _ := strconv.Atoi(strings.Split(b.CidrNotations, "/")[1])
@@ -168,12 +112,119 @@ func (b *Network) Document(jsonBytes []byte) *bluge.Document {
 	doc := bluge.NewDocument(b.ID).
 		AddField(bluge.NewStoredOnlyField("_source", jsonBytes)).
 		AddField(bluge.NewKeywordField("type", b.Type)).
-		AddField(bluge.NewTextField("cidr_notation", b.CidrNotations)).
+		AddField(bluge.NewTextField("cidr_notation", b.CidrNotations).StoreValue().HighlightMatches()).
 		AddField(bluge.NewTextField("cidr_address", cidrAddress)).
 		AddField(bluge.NewNumericField("cidr_bits", float64(cidrBits))).
 		AddField(bluge.NewNumericField("subnet_bits", float64(b.SubnetBits))).
-		AddField(bluge.NewTextField("network_address", b.NetworkAddress)).
-		AddField(bluge.NewCompositeFieldIncluding("_all", []string{"cidr_notation"}))
+		AddField(bluge.NewTextField("network_address", b.NetworkAddress))
+
+	// first_address and last_address hold the IPv4 range as numbers so that
+	// containment and overlap can be answered with numeric range queries.
+	firstAddress, lastAddress, err := prefixRange(b.CidrNotations)
+	if err == nil {
+		doc.AddField(bluge.NewNumericField("first_address", firstAddress))
+		doc.AddField(bluge.NewNumericField("last_address", lastAddress))
+	}
+
+	// cidr_prefix holds every leading octet group of the address, e.g. 161, 161.26
+	// and 161.26.28, so a partial address typed in a free-text search matches.
+	for _, prefix := range addressPrefixes(cidrAddress) {
+		doc.AddField(bluge.NewKeywordField("cidr_prefix", prefix).SearchTermPositions())
+	}
+
+	// Keyword fields are lowercased and used for filters, the _label fields keep
+	// the value as published for the facet counts, the _text fields are used for
+	// free-text search.
+	if b.DataCenter != "" {
+		doc.AddField(bluge.NewKeywordField("data_center", strings.ToLower(b.DataCenter)).Aggregatable())
+		doc.AddField(bluge.NewTextField("data_center_text", b.DataCenter).StoreValue().HighlightMatches())
+	}
+
+	if b.City != "" {
+		doc.AddField(bluge.NewTextField("city", b.City).StoreValue().HighlightMatches())
+	}
+
+	if b.Service != "" {
+		doc.AddField(bluge.NewKeywordField("service", strings.ToLower(b.Service)))
+		doc.AddField(bluge.NewKeywordField("service_label", b.Service).Aggregatable())
+		doc.AddField(bluge.NewTextField("service_text", b.Service).StoreValue().HighlightMatches())
+	}
+
+	if b.Pod != "" {
+		doc.AddField(bluge.NewKeywordField("pod", strings.ToLower(b.Pod)))
+		doc.AddField(bluge.NewTextField("pod_text", b.Pod).StoreValue().HighlightMatches())
+	}
+
+	if b.Country != "" {
+		doc.AddField(bluge.NewKeywordField("country", strings.ToLower(b.Country)))
+		doc.AddField(bluge.NewKeywordField("country_label", b.Country).Aggregatable())
+		doc.AddField(bluge.NewTextField("country_text", b.Country).StoreValue().HighlightMatches())
+	}
+
+	if b.GeoRegion != "" {
+		doc.AddField(bluge.NewKeywordField("geo_region", strings.ToLower(b.GeoRegion)))
+		doc.AddField(bluge.NewKeywordField("geo_region_label", b.GeoRegion).Aggregatable())
+		doc.AddField(bluge.NewTextField("geo_region_text", b.GeoRegion).StoreValue().HighlightMatches())
+	}
+
+	doc.AddField(bluge.NewCompositeFieldIncluding("_all", allFields))
 
 	return doc
 }
+
+// allFields are the fields included in the _all composite field used by free-text search.
+var allFields = []string{
+	"cidr_notation",
+	"cidr_prefix",
+	"data_center_text",
+	"city",
+	"service_text",
+	"pod_text",
+	"country_text",
+	"geo_region_text",
+}
+
+// addressPrefixes returns 10, 10.3, 10.3.128 and 10.3.128.0 for 10.3.128.0.
+func addressPrefixes(address string) []string {
+	octets := strings.Split(address, ".")
+	prefixes := make([]string, 0, len(octets))
+	for i := range octets {
+		prefixes = append(prefixes, strings.Join(octets[:i+1], "."))
+	}
+	return prefixes
+}
+
+// prefixRange returns the first and last address of an IPv4 CIDR as numbers.
+func prefixRange(cidr string) (first float64, last float64, err error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !prefix.Addr().Is4() {
+		return 0, 0, fmt.Errorf("only IPv4 networks can be indexed, got %s", cidr)
+	}
+
+	start := addressToUint32(prefix.Masked().Addr())
+	size := uint32(1)<<uint(32-prefix.Bits()) - 1
+	return float64(start), float64(start + size), nil
+}
+
+// addressToNumeric returns an IPv4 address as a number comparable with first_address and last_address.
+func addressToNumeric(address string) (float64, error) {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return 0, err
+	}
+
+	if !addr.Is4() {
+		return 0, fmt.Errorf("only IPv4 addresses are supported, got %s", address)
+	}
+
+	return float64(addressToUint32(addr)), nil
+}
+
+func addressToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
@@ -0,0 +1,389 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blugelabs/bluge"
+	"go.uber.org/zap"
+
+	"dprosper/calculator/internal/logger"
+	"dprosper/calculator/internal/subnetcalc"
+)
+
+const defaultBatchSize = 1000
+
+// mappingVersion is part of every content hash. Bump it whenever Document
+// changes which fields are indexed or how, so the next sync rewrites every
+// document instead of keeping the ones whose source did not change.
+const mappingVersion = "3"
+
+// IndexStats describes what a sync changed in the index.
+type IndexStats struct {
+	Added     int           `json:"added"`
+	Updated   int           `json:"updated"`
+	Deleted   int           `json:"deleted"`
+	Unchanged int           `json:"unchanged"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// IndexProgress is reported after every batch written to the index, and once
+// with Processed equal to Total when the sync completes.
+type IndexProgress struct {
+	Processed int
+	Total     int
+	IndexStats
+}
+
+// IndexResult is delivered once a background Index run completes.
+type IndexResult struct {
+	Stats IndexStats
+	Err   error
+}
+
+// Indexer keeps a bluge index in sync with a set of source documents. Documents
+// are compared by content hash, so unchanged documents are not rewritten and
+// documents that are no longer in the source are deleted.
+type Indexer struct {
+	IndexPath string
+	IndexType string
+	BatchSize int
+	Progress  func(IndexProgress)
+}
+
+type sourceDocument struct {
+	id   string
+	hash string
+	doc  *bluge.Document
+}
+
+// NewIndexer returns an Indexer for the index at indexPath.
+func NewIndexer(indexPath string, indexType string) *Indexer {
+	return &Indexer{
+		IndexPath: indexPath,
+		IndexType: indexType,
+		BatchSize: defaultBatchSize,
+	}
+}
+
+// IndexDirectory syncs the index with the per-network JSON files in sourcePath.
+func (i *Indexer) IndexDirectory(ctx context.Context, sourcePath string) (IndexStats, error) {
+	dirEntries, err := ioutil.ReadDir(sourcePath)
+	if err != nil {
+		return IndexStats{}, err
+	}
+
+	var sources []sourceDocument
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || filepath.Ext(dirEntry.Name()) != ".json" {
+			continue
+		}
+
+		obj, jsonBytes, err := parseJSONPath(i.IndexType, sourcePath, dirEntry.Name())
+		if err != nil {
+			return IndexStats{}, fmt.Errorf("error parsing JSON '%s': %w", dirEntry.Name(), err)
+		}
+
+		sources = append(sources, newSourceDocument(string(obj.Identifier()), jsonBytes, obj))
+	}
+
+	return i.sync(ctx, sources)
+}
+
+// IndexDataCenters syncs the index with every CIDR of the data set at datasetPath,
+// e.g. data/datacenters.json. Each document carries its data center and service.
+func (i *Indexer) IndexDataCenters(ctx context.Context, datasetPath string) (IndexStats, error) {
+	dataset, err := subnetcalc.LoadConfig(datasetPath)
+	if err != nil {
+		return IndexStats{}, fmt.Errorf("error reading data set '%s': %w", datasetPath, err)
+	}
+
+	sources, err := dataCenterDocuments(dataset.DataCenters)
+	if err != nil {
+		return IndexStats{}, err
+	}
+
+	return i.sync(ctx, sources)
+}
+
+func dataCenterDocuments(dataCenters []subnetcalc.DataCenter) ([]sourceDocument, error) {
+	var sources []sourceDocument
+	seen := map[string]bool{}
+
+	for _, dataCenter := range dataCenters {
+		for _, block := range dataCenter.ServiceBlocks() {
+			for _, cidr := range block.CidrBlocks {
+				if cidr == "" {
+					continue
+				}
+
+				id := networkID(dataCenter.Name, block.Service, block.Key, cidr)
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				network, err := newDataCenterNetwork(id, dataCenter, block, cidr)
+				if err != nil {
+					return nil, err
+				}
+
+				jsonBytes, err := json.Marshal(network)
+				if err != nil {
+					return nil, err
+				}
+
+				sources = append(sources, newSourceDocument(id, jsonBytes, network))
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+func newDataCenterNetwork(id string, dataCenter subnetcalc.DataCenter, block subnetcalc.ServiceBlock, cidr string) (*Network, error) {
+	if _, _, err := prefixRange(cidr); err != nil {
+		return nil, fmt.Errorf("invalid CIDR %s in %s %s: %w", cidr, dataCenter.Name, block.Service, err)
+	}
+
+	details := subnetcalc.GetSubnetDetailsV2(cidr)
+
+	return &Network{
+		ID:                  id,
+		Type:                "network",
+		DataCenter:          dataCenter.Name,
+		Service:             block.Service,
+		Pod:                 block.Key,
+		City:                dataCenter.City,
+		Country:             dataCenter.Country,
+		GeoRegion:           dataCenter.GeoRegion,
+		CidrNotations:       details.CidrNotation,
+		SubnetBits:          float64(details.SubnetBits),
+		SubnetMask:          details.SubnetMask,
+		WildcardMask:        details.WildcardMask,
+		NetworkAddress:      details.NetworkAddress,
+		BroadcastAddress:    details.BroadcastAddress,
+		AssignableHosts:     float64(details.AssignableHosts),
+		FirstAssignableHost: details.FirstAssignableHost,
+		LastAssignableHost:  details.LastAssignableHost,
+	}, nil
+}
+
+// networkID builds a stable document id such as ams03/private-network/bcr01/10.136.0.0-15.
+func networkID(dataCenter string, service string, key string, cidr string) string {
+	parts := []string{strings.ToLower(dataCenter), slug(service)}
+	if key != "" {
+		parts = append(parts, strings.ToLower(key))
+	}
+	parts = append(parts, strings.ReplaceAll(cidr, "/", "-"))
+	return strings.Join(parts, "/")
+}
+
+func slug(value string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), "-")
+}
+
+func newSourceDocument(id string, jsonBytes []byte, obj Indexable) sourceDocument {
+	sum := sha256.Sum256(append([]byte(mappingVersion+"\n"), jsonBytes...))
+	hash := hex.EncodeToString(sum[:])
+
+	doc := obj.Document(jsonBytes)
+	doc.AddField(bluge.NewStoredOnlyField("_hash", []byte(hash)))
+
+	return sourceDocument{id: id, hash: hash, doc: doc}
+}
+
+func (i *Indexer) sync(ctx context.Context, sources []sourceDocument) (IndexStats, error) {
+	startTime := time.Now()
+	logger.SystemLogger.Debug("Indexing started.", zap.String("index_path", i.IndexPath))
+
+	kwfType := bluge.NewKeywordField("_type", i.IndexType).StoreValue().Aggregatable()
+	defaultCfg := bluge.DefaultConfig(i.IndexPath).WithVirtualField(kwfType)
+
+	writer, err := bluge.OpenWriter(defaultCfg)
+	if err != nil {
+		return IndexStats{}, fmt.Errorf("error opening index '%s': %w", i.IndexPath, err)
+	}
+	defer writer.Close()
+
+	existing, err := indexedHashes(ctx, writer)
+	if err != nil {
+		return IndexStats{}, err
+	}
+
+	batchSize := i.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	var stats IndexStats
+	progress := IndexProgress{Total: len(sources)}
+	sourceIDs := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		sourceIDs[source.id] = true
+	}
+	for id := range existing {
+		if !sourceIDs[id] {
+			progress.Total++
+		}
+	}
+
+	batch := bluge.NewBatch()
+	pending := 0
+
+	reported := -1
+	report := func() {
+		if i.Progress != nil {
+			progress.IndexStats = stats
+			i.Progress(progress)
+		}
+		reported = progress.Processed
+	}
+
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := writer.Batch(batch); err != nil {
+			return fmt.Errorf("error executing batch: %w", err)
+		}
+		batch.Reset()
+		pending = 0
+
+		report()
+		return nil
+	}
+
+	for _, source := range sources {
+		progress.Processed++
+
+		hash, found := existing[source.id]
+		delete(existing, source.id)
+
+		switch {
+		case found && hash == source.hash:
+			stats.Unchanged++
+			continue
+		case found:
+			stats.Updated++
+		default:
+			stats.Added++
+		}
+
+		batch.Update(bluge.Identifier(source.id), source.doc)
+		pending++
+		if pending >= batchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	removed := make([]string, 0, len(existing))
+	for id := range existing {
+		removed = append(removed, id)
+	}
+	sort.Strings(removed)
+
+	for _, id := range removed {
+		progress.Processed++
+		stats.Deleted++
+
+		batch.Delete(bluge.Identifier(id))
+		pending++
+		if pending >= batchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return stats, err
+	}
+	// Unchanged documents are not written, so the last batch may not cover them.
+	if reported != progress.Processed {
+		report()
+	}
+
+	stats.Duration = time.Since(startTime)
+	logger.SystemLogger.Debug("Indexing completed.",
+		zap.Int("docs_added", stats.Added),
+		zap.Int("docs_updated", stats.Updated),
+		zap.Int("docs_deleted", stats.Deleted),
+		zap.Int("docs_unchanged", stats.Unchanged),
+		zap.Duration("index_time", stats.Duration),
+	)
+
+	return stats, nil
+}
+
+// indexedHashes returns the content hash of every document already in the index, by id.
+func indexedHashes(ctx context.Context, writer *bluge.Writer) (map[string]string, error) {
+	reader, err := writer.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("error opening index reader: %w", err)
+	}
+	defer reader.Close()
+
+	documentMatchIterator, err := reader.Search(ctx, bluge.NewAllMatches(bluge.NewMatchAllQuery()))
+	if err != nil {
+		return nil, fmt.Errorf("error listing indexed documents: %w", err)
+	}
+
+	hashes := map[string]string{}
+	match, err := documentMatchIterator.Next()
+	for err == nil && match != nil {
+		var id, hash string
+		err = match.VisitStoredFields(func(field string, value []byte) bool {
+			switch field {
+			case "_id":
+				id = string(value)
+			case "_hash":
+				hash = string(value)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error loading stored fields: %w", err)
+		}
+
+		hashes[id] = hash
+		match, err = documentMatchIterator.Next()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error iterating indexed documents: %w", err)
+	}
+
+	return hashes, nil
+}
@@ -18,53 +18,278 @@ package network
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
 
 	"github.com/blugelabs/bluge"
+	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"dprosper/calculator/internal/logger"
 )
 
-func Search(indexPath string, indexType string, networkAddress string, subnetBits int) (response []byte) {
+const (
+	defaultSearchSize = 10
+	maxSearchSize     = 100
+)
+
+type SearchResult struct {
+	ID         string            `json:"id"`
+	Score      float64           `json:"score"`
+	Network    *Network          `json:"network"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+	Source     json.RawMessage   `json:"-"`
+}
+
+type SearchResults struct {
+	Total  uint64                  `json:"total"`
+	From   int                     `json:"from"`
+	Size   int                     `json:"size"`
+	Hits   []SearchResult          `json:"hits"`
+	Facets map[string][]FacetCount `json:"facets,omitempty"`
+}
+
+// SearchOptions controls paging, filtering, facet counting and highlighting of a search.
+type SearchOptions struct {
+	From      int
+	Size      int
+	Filters   SearchFilters
+	Facets    bool
+	Highlight bool
+}
+
+// Search looks up the indexed networks with the given network address and subnet bits.
+func Search(indexPath string, indexType string, networkAddress string, subnetBits int, options SearchOptions) (*SearchResults, error) {
+	query := bluge.NewBooleanQuery().
+		AddMust(bluge.NewMatchQuery(networkAddress).SetField("cidr_address")).
+		AddMust(bluge.NewNumericRangeQuery(float64(subnetBits), float64(subnetBits+1)).SetField("subnet_bits"))
+
+	return Query(indexPath, indexType, query, options)
+}
+
+// Contains returns the indexed networks that contain address.
+func Contains(indexPath string, indexType string, address string, options SearchOptions) (*SearchResults, error) {
+	query, err := NewContainsQuery(address)
+	if err != nil {
+		return nil, err
+	}
+	return Query(indexPath, indexType, query, options)
+}
+
+// Overlaps returns the indexed networks that overlap cidr.
+func Overlaps(indexPath string, indexType string, cidr string, options SearchOptions) (*SearchResults, error) {
+	query, err := NewOverlapsQuery(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return Query(indexPath, indexType, query, options)
+}
+
+// Query runs query against the index and returns one page of scored results,
+// narrowed by the filters of options and with facet counts when requested.
+func Query(indexPath string, indexType string, query bluge.Query, options SearchOptions) (*SearchResults, error) {
+	from := options.From
+	size := options.Size
+	if from < 0 {
+		from = 0
+	}
+	if size <= 0 {
+		size = defaultSearchSize
+	}
+	if size > maxSearchSize {
+		size = maxSearchSize
+	}
+
 	kwfType := bluge.NewKeywordField("_type", indexType).StoreValue().Aggregatable()
 	defaultCfg := bluge.DefaultConfig(indexPath).WithVirtualField(kwfType)
 
-	var indexResponse []byte
-
 	indexReader, err := bluge.OpenReader(defaultCfg)
 	if err != nil {
-		logger.ErrorLogger.Fatal("unable to open snapshot reader", zap.String("error: ", err.Error()))
+		return nil, fmt.Errorf("unable to open snapshot reader: %w", err)
 	}
 	defer indexReader.Close()
 
-	query := bluge.NewBooleanQuery().
-		AddMust(bluge.NewMatchQuery(networkAddress).SetField("cidr_address")).
-		AddMust(bluge.NewNumericRangeQuery(float64(subnetBits), float64(subnetBits+1)).SetField("subnet_bits"))
-
-	request := bluge.NewTopNSearch(5, query).WithStandardAggregations()
+	request := bluge.NewTopNSearch(size, options.Filters.apply(query)).SetFrom(from).WithStandardAggregations()
+	if options.Facets {
+		addFacetAggregations(request)
+	}
+	if options.Highlight {
+		request.IncludeLocations()
+	}
 
 	documentMatchIterator, err := indexReader.Search(context.Background(), request)
 	if err != nil {
-		logger.ErrorLogger.Fatal("error executing search", zap.String("error: ", err.Error()))
+		return nil, fmt.Errorf("error executing search: %w", err)
+	}
+
+	results := &SearchResults{
+		From: from,
+		Size: size,
+		Hits: []SearchResult{},
 	}
 
 	match, err := documentMatchIterator.Next()
 	for err == nil && match != nil {
+		result := SearchResult{Score: match.Score}
+		stored := map[string][]byte{}
 		err = match.VisitStoredFields(func(field string, value []byte) bool {
-			if field == "_source" {
-				indexResponse = value
+			switch field {
+			case "_id":
+				result.ID = string(value)
+			case "_source":
+				result.Source = append([]byte(nil), value...)
+			default:
+				stored[field] = append([]byte(nil), value...)
 			}
 			return true
 		})
-
 		if err != nil {
-			logger.ErrorLogger.Fatal("error loading stored fields", zap.String("error: ", err.Error()))
+			return nil, fmt.Errorf("error loading stored fields: %w", err)
+		}
+
+		if options.Highlight {
+			result.Highlights = highlights(match, stored)
+		}
+
+		if result.Source != nil {
+			result.Network = NewNetwork(result.ID)
+			err = json.Unmarshal(result.Source, result.Network)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding document '%s': %w", result.ID, err)
+			}
 		}
+
+		results.Hits = append(results.Hits, result)
 		match, err = documentMatchIterator.Next()
 	}
 
 	if err != nil {
-		logger.ErrorLogger.Fatal("error iterator document matches", zap.String("error: ", err.Error()))
+		return nil, fmt.Errorf("error iterating document matches: %w", err)
+	}
+
+	results.Total = documentMatchIterator.Aggregations().Count()
+	if options.Facets {
+		results.Facets = facetCounts(documentMatchIterator.Aggregations())
+	}
+
+	return results, nil
+}
+
+// SearchHandler serves index lookups. One of the q (free text), cidr, contains or overlaps
+// query parameters selects the lookup, all networks are searched when none is given.
+// The data_center, geo_region, country, service and subnet_bits parameters filter
+// the results, facets=true adds facet counts and from and size page through the results.
+func SearchHandler(indexPath string, indexType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := strconv.Atoi(c.DefaultQuery("from", "0"))
+		if err != nil || from < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "from must be a positive number."})
+			return
+		}
+
+		size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(defaultSearchSize)))
+		if err != nil || size < 1 || size > maxSearchSize {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("size must be between 1 and %d.", maxSearchSize)})
+			return
+		}
+
+		var query bluge.Query
+		switch {
+		case c.Query("q") != "":
+			query, err = NewTextQuery(c.Query("q"))
+		case c.Query("cidr") != "":
+			query, err = NewExactQuery(c.Query("cidr"))
+		case c.Query("contains") != "":
+			query, err = NewContainsQuery(c.Query("contains"))
+		case c.Query("overlaps") != "":
+			query, err = NewOverlapsQuery(c.Query("overlaps"))
+		default:
+			query = bluge.NewMatchAllQuery()
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		filters, err := filtersFromRequest(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		options := SearchOptions{
+			From:      from,
+			Size:      size,
+			Filters:   filters,
+			Facets:    c.Query("facets") == "true",
+			Highlight: c.Query("q") != "",
+		}
+
+		results, err := Query(indexPath, indexType, query, options)
+		if err != nil {
+			logger.ErrorLogger.Error("error searching index", zap.String("index_path", indexPath), zap.String("error: ", err.Error()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Search failed."})
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// NewExactQuery matches the indexed networks with exactly the range of cidr.
+func NewExactQuery(cidr string) (bluge.Query, error) {
+	first, last, err := prefixRange(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	query := bluge.NewBooleanQuery().
+		AddMust(bluge.NewNumericRangeInclusiveQuery(first, first, true, true).SetField("first_address")).
+		AddMust(bluge.NewNumericRangeInclusiveQuery(last, last, true, true).SetField("last_address"))
+
+	return query, nil
+}
+
+// NewContainsQuery matches every indexed network that contains address.
+func NewContainsQuery(address string) (bluge.Query, error) {
+	value, err := addressToNumeric(address)
+	if err != nil {
+		return nil, err
 	}
-	return indexResponse
+
+	query := bluge.NewBooleanQuery().
+		AddMust(bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, value, true, true).SetField("first_address")).
+		AddMust(bluge.NewNumericRangeInclusiveQuery(value, bluge.MaxNumeric, true, true).SetField("last_address"))
+
+	return query, nil
+}
+
+// NewOverlapsQuery matches every indexed network that shares at least one address with cidr.
+func NewOverlapsQuery(cidr string) (bluge.Query, error) {
+	first, last, err := prefixRange(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	query := bluge.NewBooleanQuery().
+		AddMust(bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, last, true, true).SetField("first_address")).
+		AddMust(bluge.NewNumericRangeInclusiveQuery(first, bluge.MaxNumeric, true, true).SetField("last_address"))
+
+	return query, nil
+}
+
+// NewWithinQuery matches every indexed network that is fully inside cidr.
+func NewWithinQuery(cidr string) (bluge.Query, error) {
+	first, last, err := prefixRange(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	query := bluge.NewBooleanQuery().
+		AddMust(bluge.NewNumericRangeInclusiveQuery(first, bluge.MaxNumeric, true, true).SetField("first_address")).
+		AddMust(bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, last, true, true).SetField("last_address"))
+
+	return query, nil
 }
@@ -0,0 +1,105 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/search"
+	"github.com/blugelabs/bluge/search/highlight"
+)
+
+// highlightFields are the stored text fields returned as highlights, by the
+// name used in the response.
+var highlightFields = map[string]string{
+	"data_center_text": "data_center",
+	"city":             "city",
+	"service_text":     "service",
+	"pod_text":         "pod",
+	"country_text":     "country",
+	"geo_region_text":  "geo_region",
+	"cidr_notation":    "cidr_notation",
+}
+
+// Text searches the indexed networks for free text such as "amsterdam icos",
+// "bcr02 ams03" or "161.26.28". Results carry highlighted fields.
+func Text(indexPath string, indexType string, text string, options SearchOptions) (*SearchResults, error) {
+	query, err := NewTextQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	options.Highlight = true
+	return Query(indexPath, indexType, query, options)
+}
+
+// NewTextQuery builds a free-text query. Every term has to match the _all field,
+// matches on the individual fields raise the score and are used for highlighting.
+func NewTextQuery(text string) (bluge.Query, error) {
+	terms := strings.Fields(strings.ToLower(text))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search text is empty")
+	}
+
+	query := bluge.NewBooleanQuery().
+		AddMust(bluge.NewMatchQuery(strings.Join(terms, " ")).SetField("_all").SetOperator(bluge.MatchQueryOperatorAnd))
+
+	for field := range highlightFields {
+		query.AddShould(bluge.NewMatchQuery(strings.Join(terms, " ")).SetField(field))
+	}
+
+	for _, term := range terms {
+		query.AddShould(bluge.NewTermQuery(term).SetField("cidr_prefix"))
+	}
+
+	return query, nil
+}
+
+// highlights marks the matched terms of the stored fields of a match.
+func highlights(match *search.DocumentMatch, stored map[string][]byte) map[string]string {
+	highlighter := highlight.NewHTMLHighlighterTags("<mark>", "</mark>")
+	result := map[string]string{}
+
+	for field, name := range highlightFields {
+		locations, ok := match.Locations[field]
+		if !ok || len(locations) == 0 || stored[field] == nil {
+			continue
+		}
+		result[name] = highlighter.BestFragment(locations, stored[field])
+	}
+
+	if _, ok := result["cidr_notation"]; !ok && stored["cidr_notation"] != nil {
+		longest := ""
+		for term := range match.Locations["cidr_prefix"] {
+			if len(term) > len(longest) {
+				longest = term
+			}
+		}
+
+		cidr := string(stored["cidr_notation"])
+		if longest != "" && strings.HasPrefix(cidr, longest) {
+			result["cidr_notation"] = "<mark>" + html.EscapeString(longest) + "</mark>" + html.EscapeString(cidr[len(longest):])
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
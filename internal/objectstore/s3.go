@@ -0,0 +1,218 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config holds the connection details of an S3-compatible bucket, such as IBM
+// Cloud Object Storage with HMAC credentials.
+type Config struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	Region          string `mapstructure:"region"`
+	Bucket          string `mapstructure:"bucket"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of
+	// bucket.endpoint/key, as needed by most local S3 stand-ins.
+	PathStyle bool `mapstructure:"path_style"`
+}
+
+// Client uploads objects with AWS Signature Version 4.
+type Client struct {
+	config     Config
+	endpoint   *url.URL
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewClient validates config and returns a client for its bucket.
+func NewClient(config Config) (*Client, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("object storage endpoint and bucket are required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("object storage HMAC access key id and secret access key are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	endpoint := config.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, fmt.Errorf("invalid object storage endpoint %q", config.Endpoint)
+	}
+
+	return &Client{
+		config:     config,
+		endpoint:   endpointURL,
+		httpClient: &http.Client{Timeout: time.Duration(60 * time.Second)},
+		now:        time.Now,
+	}, nil
+}
+
+// Bucket returns the name of the bucket objects are written to.
+func (c *Client) Bucket() string {
+	return c.config.Bucket
+}
+
+// PutObject uploads data to key. The SHA-256 of data is stored in the
+// x-amz-meta-sha256 metadata next to the given metadata, and Content-MD5 lets
+// the service reject a corrupted upload.
+func (c *Client) PutObject(key string, data []byte, contentType string, metadata map[string]string) error {
+	request, err := http.NewRequest(http.MethodPut, c.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	payloadHash := sha256Hex(data)
+	md5Sum := md5.Sum(data)
+
+	request.ContentLength = int64(len(data))
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]))
+	request.Header.Set("X-Amz-Meta-Sha256", payloadHash)
+	for name, value := range metadata {
+		request.Header.Set("X-Amz-Meta-"+name, value)
+	}
+
+	c.sign(request, payloadHash)
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %w", key, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("error uploading %s: %s: %s", key, response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (c *Client) objectURL(key string) string {
+	objectURL := *c.endpoint
+	key = strings.TrimPrefix(key, "/")
+
+	if c.config.PathStyle {
+		objectURL.Path = "/" + c.config.Bucket + "/" + key
+	} else {
+		objectURL.Host = c.config.Bucket + "." + objectURL.Host
+		objectURL.Path = "/" + key
+	}
+	objectURL.RawPath = ""
+
+	return objectURL.String()
+}
+
+// sign adds the AWS Signature Version 4 Authorization header to request.
+func (c *Client) sign(request *http.Request, payloadHash string) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.config.SecretAccessKey), day)
+	key = hmacSHA256(key, c.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		for _, value := range values[key] {
+			parts = append(parts, url.QueryEscape(key)+"="+strings.ReplaceAll(url.QueryEscape(value), "+", "%20"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package subnetcalc
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"dprosper/calculator/internal/logger"
+)
+
+// Flow is a connection a service needs to its ranges, from the required flows
+// of ips.md. Direction is inbound or outbound, Protocol tcp, udp, icmp or any.
+// Ports is a port or a range such as 48000-48020, empty for every port.
+type Flow struct {
+	Direction string `mapstructure:"direction" json:"direction"`
+	Protocol  string `mapstructure:"protocol" json:"protocol"`
+	Ports     string `mapstructure:"ports" json:"ports,omitempty"`
+}
+
+// String returns the flow as in "outbound tcp 443".
+func (f Flow) String() string {
+	return strings.TrimSpace(f.Direction + " " + f.Protocol + " " + f.Ports)
+}
+
+// FlowRule is a flow to one CIDR block of a data center, the unit of a
+// firewall rule.
+type FlowRule struct {
+	DataCenter string `json:"data_center"`
+	Service    string `json:"service"`
+	Cidr       string `json:"cidr"`
+	Flow
+}
+
+// FlowRules lists a rule for each flow and CIDR block of the services that have
+// required flows. dataCenters and services select data centers and service
+// labels, case-insensitive, all when empty.
+func FlowRules(dataCenters []DataCenter, selectedDataCenters []string, services []string) []FlowRule {
+	rules := []FlowRule{}
+	for _, dataCenter := range dataCenters {
+		if !containsFold(selectedDataCenters, dataCenter.Name) {
+			continue
+		}
+		for _, block := range dataCenter.ServiceBlocks() {
+			if len(block.Flows) == 0 || !containsFold(services, block.Service) {
+				continue
+			}
+			for _, cidr := range block.CidrBlocks {
+				for _, flow := range block.Flows {
+					rules = append(rules, FlowRule{DataCenter: dataCenter.Name, Service: block.Service, Cidr: cidr, Flow: flow})
+				}
+			}
+		}
+	}
+	return rules
+}
+
+func containsFold(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// FlowsHandler serves the FlowRules of the data set in datasetPath. The
+// data_center and service query parameters, repeatable, select data centers and
+// services.
+func FlowsHandler(datasetPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataset, err := LoadConfig(datasetPath)
+		if err != nil {
+			logger.ErrorLogger.Error("error reading data set", zap.String("path", datasetPath), zap.String("error: ", err.Error()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Data set is not available."})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"last_updated": dataset.LastUpdated,
+			"flows":        FlowRules(dataset.DataCenters, c.QueryArray("data_center"), c.QueryArray("service")),
+		})
+	}
+}
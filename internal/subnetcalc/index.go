@@ -17,7 +17,6 @@ limitations under the License.
 package subnetcalc
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/netip"
@@ -37,6 +36,8 @@ import (
 type SubmittedCidr struct {
 	Cidr                string   `json:"cidr" validate:"required,cidrv4"`
 	SelectedDataCenters []string `json:"selected_data_centers"`
+	// ExcludeClosing leaves out the data centers that are closing or closed.
+	ExcludeClosing bool `json:"exclude_closing"`
 	// Filter             string   `json:"filter"`
 }
 
@@ -63,6 +64,8 @@ type Address struct {
 }
 
 type Config struct {
+	Schema               string       `mapstructure:"$schema" json:"$schema,omitempty"`
+	SchemaVersion        string       `mapstructure:"schema_version" json:"schema_version,omitempty"`
 	Name                 string       `mapstructure:"name" json:"name"`
 	Type                 string       `mapstructure:"type" json:"type"`
 	Version              string       `mapstructure:"version" json:"version"`
@@ -77,23 +80,44 @@ type Config struct {
 }
 
 type DataCenter struct {
-	Key             string           `mapstructure:"key" json:"key"`
-	Name            string           `mapstructure:"name" json:"name"`
-	City            string           `mapstructure:"city" json:"city"`
-	State           string           `mapstructure:"state" json:"state"`
-	Country         string           `mapstructure:"country" json:"country"`
-	GeoRegion       string           `mapstructure:"geo_region" json:"geo_region"`
+	Key       string `mapstructure:"key" json:"key"`
+	Name      string `mapstructure:"name" json:"name"`
+	City      string `mapstructure:"city" json:"city"`
+	State     string `mapstructure:"state" json:"state"`
+	Country   string `mapstructure:"country" json:"country"`
+	GeoRegion string `mapstructure:"geo_region" json:"geo_region"`
+	// Status is StatusActive when empty. ClosureDate is the announced closure,
+	// as ClosureDateLayout.
+	Status          string           `mapstructure:"status" json:"status,omitempty"`
+	ClosureDate     string           `mapstructure:"closure_date" json:"closure_date,omitempty"`
+	FrontEndPublic  []FrontEndPublic `mapstructure:"front_end_public_network" json:"front_end_public_network"`
+	LoadBalancerIPs []LoadBalancerIP `mapstructure:"load_balancers_ips" json:"load_balancers_ips"`
 	PrivateNetworks []PrivateNetwork `mapstructure:"private_networks" json:"private_networks"`
 	ServiceNetwork  []ServiceNetwork `mapstructure:"service_network" json:"service_network"`
 	SslVpn          []SslVpn         `mapstructure:"ssl_vpn" json:"ssl_vpn"`
+	SslVpnPops      []SslVpnPop      `mapstructure:"ssl_vpn_pops" json:"ssl_vpn_pops"`
 	Evault          []Evault         `mapstructure:"evault" json:"evault"`
 	FileBlock       []FileBlock      `mapstructure:"file_block" json:"file_block"`
 	Icos            []Icos           `mapstructure:"icos" json:"icos"`
 	AdvMon          []AdvMon         `mapstructure:"advmon" json:"advmon"`
 	RHELS           []RHELS          `mapstructure:"rhe_ls" json:"rhe_ls"`
 	IMS             []IMS            `mapstructure:"ims" json:"ims"`
+	LegacyNetworks  []LegacyNetwork  `mapstructure:"legacy_networks" json:"legacy_networks"`
+	WindowsVsi      []WindowsVsi     `mapstructure:"windows_vsi" json:"windows_vsi"`
 	CidrNetworks    []CidrNetwork    `json:"cidr_networks"`
 	Conflict        bool             `json:"conflict"`
+	// PublicCidrNetworks are the front-end and load balancer ranges. They are checked
+	// separately and do not set Conflict.
+	PublicCidrNetworks []CidrNetwork `json:"public_cidr_networks,omitempty"`
+	PublicConflict     bool          `json:"public_conflict,omitempty"`
+}
+
+type FrontEndPublic struct {
+	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+}
+
+type LoadBalancerIP struct {
+	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
 }
 
 type PrivateNetwork struct {
@@ -110,27 +134,47 @@ type SslVpn struct {
 	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
 }
 
+type SslVpnPop struct {
+	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+}
+
 type Evault struct {
 	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+	Flows      []Flow   `mapstructure:"flows" json:"flows,omitempty"`
 }
 
 type FileBlock struct {
 	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+	Flows      []Flow   `mapstructure:"flows" json:"flows,omitempty"`
 }
 
 type Icos struct {
 	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+	Flows      []Flow   `mapstructure:"flows" json:"flows,omitempty"`
 }
 
 type AdvMon struct {
 	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+	Flows      []Flow   `mapstructure:"flows" json:"flows,omitempty"`
 }
 
+// RHELS and IMS hold the service network of another data center, named in
+// OriginDataCenter, as set by the service dependency rules of the updater.
 type RHELS struct {
-	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+	OriginDataCenter string   `mapstructure:"origin_data_center" json:"origin_data_center,omitempty"`
+	CidrBlocks       []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
 }
 
 type IMS struct {
+	OriginDataCenter string   `mapstructure:"origin_data_center" json:"origin_data_center,omitempty"`
+	CidrBlocks       []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+}
+
+type LegacyNetwork struct {
+	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
+}
+
+type WindowsVsi struct {
 	CidrBlocks []string `mapstructure:"cidr_blocks" json:"cidr_blocks"`
 }
 
@@ -146,6 +190,10 @@ type CidrNetwork struct {
 	FirstAssignableHost string `json:"first_assignable_host"`
 	LastAssignableHost  string `json:"last_assignable_host"`
 	Conflict            bool   `json:"conflict"`
+	// OriginDataCenter is the data center of a RHEL or IMS range.
+	OriginDataCenter string `json:"origin_data_center,omitempty"`
+	// Flows are the required flows of the service to the range.
+	Flows []Flow `json:"flows,omitempty"`
 }
 
 // getSubnetDetailsV2 function
@@ -232,6 +280,7 @@ func ReadMiddleware() gin.HandlerFunc {
 		var Validator = validator.New()
 		var errors []*IError
 		var selectedDataCenters []string
+		var excludeClosing bool
 
 		json := new(SubmittedCidr)
 		cidr := "0.0.0.0/0"
@@ -265,7 +314,7 @@ func ReadMiddleware() gin.HandlerFunc {
 					zap.String("client_loc", c.Request.Header.Get("X-Calculator-Client-Loc")),
 				)
 
-				data, err := readDataCenters(cidr, selectedDataCenters)
+				data, err := readDataCenters(cidr, selectedDataCenters, json.ExcludeClosing)
 				if err != nil {
 					success = false
 					c.JSON(http.StatusOK, success)
@@ -278,6 +327,7 @@ func ReadMiddleware() gin.HandlerFunc {
 			} else {
 				cidr = json.Cidr
 				selectedDataCenters = json.SelectedDataCenters
+				excludeClosing = json.ExcludeClosing
 			}
 		} else {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Invalid json was provided in the post."})
@@ -292,14 +342,27 @@ func ReadMiddleware() gin.HandlerFunc {
 			zap.String("client_loc", c.Request.Header.Get("X-Calculator-Client-Loc")),
 		)
 
+		reportFormat, err := NegotiateReportFormat(c.Query("format"), c.GetHeader("Accept"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
 		success := true
-		data, err := runSubnetCalculator(cidr, selectedDataCenters)
+		data, err := runSubnetCalculator(cidr, selectedDataCenters, excludeClosing)
 		if err != nil {
 			success = false
 			c.JSON(http.StatusOK, success)
 			c.Abort()
-		} else {
+		} else if reportFormat == ReportJSON {
 			c.JSON(http.StatusOK, data)
+		} else {
+			c.Status(http.StatusOK)
+			c.Header("Content-Type", reportFormat.ContentType())
+			err = NewReport(data).Render(c.Writer, reportFormat)
+			if err != nil {
+				logger.ErrorLogger.Error("error rendering report", zap.String("format", string(reportFormat)), zap.String("error: ", err.Error()))
+			}
 		}
 	}
 }
@@ -329,18 +392,56 @@ func Contains(s []string, str string) bool {
 	return true
 }
 
-func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Config, error) {
-	var tmpConfig Config
-	file, _ := os.ReadFile("ip-ranges.json")
+func runSubnetCalculator(requestedCidr string, selectedDataCenters []string, excludeClosing bool) (Config, error) {
+	tmpConfig, err := LoadConfig("ip-ranges.json")
+	if err != nil {
+		logger.ErrorLogger.Error("error loading the data set.", zap.String("error: ", err.Error()))
+		return Config{}, err
+	}
 
-	err := json.Unmarshal([]byte(file), &tmpConfig)
+	if excludeClosing {
+		tmpConfig.DataCenters = ExcludeClosing(tmpConfig.DataCenters)
+	}
+
+	requestedCidrNetwork, dataCentersOutput := CalculateConflicts(tmpConfig.DataCenters, requestedCidr, selectedDataCenters)
+
+	config := Config{
+		Name:                 viper.GetString("name"),
+		Type:                 viper.GetString("type"),
+		Version:              viper.GetString("version"),
+		LastUpdated:          viper.GetString("last_updated"),
+		ReleaseNotes:         viper.GetString("release_notes"),
+		Source:               viper.GetString("source"),
+		SourceJson:           viper.GetString("source_json"),
+		Issues:               viper.GetString("issues"),
+		RequestedCidr:        requestedCidr,
+		RequestedCidrNetwork: requestedCidrNetwork,
+		DataCenters:          dataCentersOutput,
+	}
+
+	return config, nil
+}
+
+// LoadConfig reads a published data set such as data/datacenters.json. Older
+// data sets are migrated to SchemaVersion.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	file, err := os.ReadFile(path)
 	if err != nil {
-		logger.ErrorLogger.Fatal(fmt.Sprintf("found an error: %v", err))
 		return Config{}, err
 	}
 
-	dataCenters := tmpConfig.DataCenters
+	err = DecodeDataset(file, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	return config, nil
+}
 
+// CalculateConflicts compares requestedCidr with every CIDR of the selected data centers.
+// It returns the details of the requested network and the data centers with each conflict flagged.
+func CalculateConflicts(dataCenters []DataCenter, requestedCidr string, selectedDataCenters []string) (CidrNetwork, []DataCenter) {
 	dataCentersOutput := []DataCenter{}
 
 	requestedDetails := GetSubnetDetailsV2(requestedCidr)
@@ -469,7 +570,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 
 		evaultOutput := []Evault{}
 		for _, evault := range dataCenter.Evault {
-			evaultJson := Evault{CidrBlocks: evault.CidrBlocks}
+			evaultJson := Evault{CidrBlocks: evault.CidrBlocks, Flows: evault.Flows}
 			evaultOutput = append(evaultOutput, evaultJson)
 
 			for _, cloudCidr := range evault.CidrBlocks {
@@ -488,6 +589,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 					FirstAssignableHost: cloudDetails.FirstAssignableHost,
 					LastAssignableHost:  cloudDetails.LastAssignableHost,
 					Conflict:            cidrConflict,
+					Flows:               evault.Flows,
 				}
 
 				if cidrConflict {
@@ -500,7 +602,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 
 		icosOutput := []Icos{}
 		for _, icos := range dataCenter.Icos {
-			icosJson := Icos{CidrBlocks: icos.CidrBlocks}
+			icosJson := Icos{CidrBlocks: icos.CidrBlocks, Flows: icos.Flows}
 			icosOutput = append(icosOutput, icosJson)
 
 			for _, cloudCidr := range icos.CidrBlocks {
@@ -519,6 +621,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 					FirstAssignableHost: cloudDetails.FirstAssignableHost,
 					LastAssignableHost:  cloudDetails.LastAssignableHost,
 					Conflict:            cidrConflict,
+					Flows:               icos.Flows,
 				}
 
 				if cidrConflict {
@@ -531,7 +634,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 
 		fileblockOutput := []FileBlock{}
 		for _, fileblock := range dataCenter.FileBlock {
-			fileblockJson := FileBlock{CidrBlocks: fileblock.CidrBlocks}
+			fileblockJson := FileBlock{CidrBlocks: fileblock.CidrBlocks, Flows: fileblock.Flows}
 			fileblockOutput = append(fileblockOutput, fileblockJson)
 
 			for _, cloudCidr := range fileblock.CidrBlocks {
@@ -550,6 +653,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 					FirstAssignableHost: cloudDetails.FirstAssignableHost,
 					LastAssignableHost:  cloudDetails.LastAssignableHost,
 					Conflict:            cidrConflict,
+					Flows:               fileblock.Flows,
 				}
 
 				if cidrConflict {
@@ -562,7 +666,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 
 		advmonOutput := []AdvMon{}
 		for _, advmon := range dataCenter.AdvMon {
-			advmonJson := AdvMon{CidrBlocks: advmon.CidrBlocks}
+			advmonJson := AdvMon{CidrBlocks: advmon.CidrBlocks, Flows: advmon.Flows}
 			advmonOutput = append(advmonOutput, advmonJson)
 
 			for _, cloudCidr := range advmon.CidrBlocks {
@@ -581,6 +685,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 					FirstAssignableHost: cloudDetails.FirstAssignableHost,
 					LastAssignableHost:  cloudDetails.LastAssignableHost,
 					Conflict:            cidrConflict,
+					Flows:               advmon.Flows,
 				}
 
 				if cidrConflict {
@@ -593,7 +698,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 
 		rhelsOutput := []RHELS{}
 		for _, rhels := range dataCenter.RHELS {
-			rhelsJson := RHELS{CidrBlocks: rhels.CidrBlocks}
+			rhelsJson := RHELS{OriginDataCenter: rhels.OriginDataCenter, CidrBlocks: rhels.CidrBlocks}
 			rhelsOutput = append(rhelsOutput, rhelsJson)
 
 			for _, cloudCidr := range rhels.CidrBlocks {
@@ -612,6 +717,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 					FirstAssignableHost: cloudDetails.FirstAssignableHost,
 					LastAssignableHost:  cloudDetails.LastAssignableHost,
 					Conflict:            cidrConflict,
+					OriginDataCenter:    rhels.OriginDataCenter,
 				}
 
 				if cidrConflict {
@@ -624,7 +730,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 
 		imsOutput := []IMS{}
 		for _, ims := range dataCenter.IMS {
-			imsJson := IMS{CidrBlocks: ims.CidrBlocks}
+			imsJson := IMS{OriginDataCenter: ims.OriginDataCenter, CidrBlocks: ims.CidrBlocks}
 			imsOutput = append(imsOutput, imsJson)
 
 			for _, cloudCidr := range ims.CidrBlocks {
@@ -643,6 +749,69 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 					FirstAssignableHost: cloudDetails.FirstAssignableHost,
 					LastAssignableHost:  cloudDetails.LastAssignableHost,
 					Conflict:            cidrConflict,
+					OriginDataCenter:    ims.OriginDataCenter,
+				}
+
+				if cidrConflict {
+					dataCenterConflict = true
+				}
+
+				cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+			}
+		}
+
+		legacyNetworksOutput := []LegacyNetwork{}
+		for _, legacyNetwork := range dataCenter.LegacyNetworks {
+			legacyNetworkJson := LegacyNetwork{CidrBlocks: legacyNetwork.CidrBlocks}
+			legacyNetworksOutput = append(legacyNetworksOutput, legacyNetworkJson)
+
+			for _, cloudCidr := range legacyNetwork.CidrBlocks {
+				cloudDetails := GetSubnetDetailsV2(cloudCidr)
+				cidrConflict = CompareCidrNetworksV2(requestedCidr, cloudCidr)
+
+				cloudCidrNetwork := CidrNetwork{
+					Service:             ServiceLegacyNetwork,
+					CidrNotation:        cloudDetails.CidrNotation,
+					SubnetBits:          cloudDetails.SubnetBits,
+					SubnetMask:          cloudDetails.SubnetMask,
+					WildcardMask:        cloudDetails.WildcardMask,
+					NetworkAddress:      cloudDetails.NetworkAddress,
+					BroadcastAddress:    cloudDetails.BroadcastAddress,
+					AssignableHosts:     cloudDetails.AssignableHosts,
+					FirstAssignableHost: cloudDetails.FirstAssignableHost,
+					LastAssignableHost:  cloudDetails.LastAssignableHost,
+					Conflict:            cidrConflict,
+				}
+
+				if cidrConflict {
+					dataCenterConflict = true
+				}
+
+				cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+			}
+		}
+
+		windowsVsiOutput := []WindowsVsi{}
+		for _, windowsVsi := range dataCenter.WindowsVsi {
+			windowsVsiJson := WindowsVsi{CidrBlocks: windowsVsi.CidrBlocks}
+			windowsVsiOutput = append(windowsVsiOutput, windowsVsiJson)
+
+			for _, cloudCidr := range windowsVsi.CidrBlocks {
+				cloudDetails := GetSubnetDetailsV2(cloudCidr)
+				cidrConflict = CompareCidrNetworksV2(requestedCidr, cloudCidr)
+
+				cloudCidrNetwork := CidrNetwork{
+					Service:             ServiceWindowsVsi,
+					CidrNotation:        cloudDetails.CidrNotation,
+					SubnetBits:          cloudDetails.SubnetBits,
+					SubnetMask:          cloudDetails.SubnetMask,
+					WildcardMask:        cloudDetails.WildcardMask,
+					NetworkAddress:      cloudDetails.NetworkAddress,
+					BroadcastAddress:    cloudDetails.BroadcastAddress,
+					AssignableHosts:     cloudDetails.AssignableHosts,
+					FirstAssignableHost: cloudDetails.FirstAssignableHost,
+					LastAssignableHost:  cloudDetails.LastAssignableHost,
+					Conflict:            cidrConflict,
 				}
 
 				if cidrConflict {
@@ -653,6 +822,103 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 			}
 		}
 
+		sslVpnPopsOutput := []SslVpnPop{}
+		for _, sslVpnPop := range dataCenter.SslVpnPops {
+			sslVpnPopJson := SslVpnPop{CidrBlocks: sslVpnPop.CidrBlocks}
+			sslVpnPopsOutput = append(sslVpnPopsOutput, sslVpnPopJson)
+
+			for _, cloudCidr := range sslVpnPop.CidrBlocks {
+				cloudDetails := GetSubnetDetailsV2(cloudCidr)
+				cidrConflict = CompareCidrNetworksV2(requestedCidr, cloudCidr)
+
+				cloudCidrNetwork := CidrNetwork{
+					Service:             ServiceSslVpnPop,
+					CidrNotation:        cloudDetails.CidrNotation,
+					SubnetBits:          cloudDetails.SubnetBits,
+					SubnetMask:          cloudDetails.SubnetMask,
+					WildcardMask:        cloudDetails.WildcardMask,
+					NetworkAddress:      cloudDetails.NetworkAddress,
+					BroadcastAddress:    cloudDetails.BroadcastAddress,
+					AssignableHosts:     cloudDetails.AssignableHosts,
+					FirstAssignableHost: cloudDetails.FirstAssignableHost,
+					LastAssignableHost:  cloudDetails.LastAssignableHost,
+					Conflict:            cidrConflict,
+				}
+
+				if cidrConflict {
+					dataCenterConflict = true
+				}
+
+				cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+			}
+		}
+
+		// Public ranges are reported on their own, a private plan never conflicts with them.
+		publicConflict := false
+		publicCidrNetworks := []CidrNetwork{}
+
+		frontEndPublicOutput := []FrontEndPublic{}
+		for _, frontEndPublic := range dataCenter.FrontEndPublic {
+			frontEndPublicJson := FrontEndPublic{CidrBlocks: frontEndPublic.CidrBlocks}
+			frontEndPublicOutput = append(frontEndPublicOutput, frontEndPublicJson)
+
+			for _, cloudCidr := range frontEndPublic.CidrBlocks {
+				cloudDetails := GetSubnetDetailsV2(cloudCidr)
+				cidrConflict = CompareCidrNetworksV2(requestedCidr, cloudCidr)
+
+				cloudCidrNetwork := CidrNetwork{
+					Service:             ServiceFrontEndPublic,
+					CidrNotation:        cloudDetails.CidrNotation,
+					SubnetBits:          cloudDetails.SubnetBits,
+					SubnetMask:          cloudDetails.SubnetMask,
+					WildcardMask:        cloudDetails.WildcardMask,
+					NetworkAddress:      cloudDetails.NetworkAddress,
+					BroadcastAddress:    cloudDetails.BroadcastAddress,
+					AssignableHosts:     cloudDetails.AssignableHosts,
+					FirstAssignableHost: cloudDetails.FirstAssignableHost,
+					LastAssignableHost:  cloudDetails.LastAssignableHost,
+					Conflict:            cidrConflict,
+				}
+
+				if cidrConflict {
+					publicConflict = true
+				}
+
+				publicCidrNetworks = append(publicCidrNetworks, cloudCidrNetwork)
+			}
+		}
+
+		loadBalancerIPsOutput := []LoadBalancerIP{}
+		for _, loadBalancerIP := range dataCenter.LoadBalancerIPs {
+			loadBalancerIPJson := LoadBalancerIP{CidrBlocks: loadBalancerIP.CidrBlocks}
+			loadBalancerIPsOutput = append(loadBalancerIPsOutput, loadBalancerIPJson)
+
+			for _, cloudCidr := range loadBalancerIP.CidrBlocks {
+				cloudDetails := GetSubnetDetailsV2(cloudCidr)
+				cidrConflict = CompareCidrNetworksV2(requestedCidr, cloudCidr)
+
+				cloudCidrNetwork := CidrNetwork{
+					Service:             ServiceLoadBalancer,
+					CidrNotation:        cloudDetails.CidrNotation,
+					SubnetBits:          cloudDetails.SubnetBits,
+					SubnetMask:          cloudDetails.SubnetMask,
+					WildcardMask:        cloudDetails.WildcardMask,
+					NetworkAddress:      cloudDetails.NetworkAddress,
+					BroadcastAddress:    cloudDetails.BroadcastAddress,
+					AssignableHosts:     cloudDetails.AssignableHosts,
+					FirstAssignableHost: cloudDetails.FirstAssignableHost,
+					LastAssignableHost:  cloudDetails.LastAssignableHost,
+					Conflict:            cidrConflict,
+				}
+
+				if cidrConflict {
+					publicConflict = true
+				}
+
+				publicCidrNetworks = append(publicCidrNetworks, cloudCidrNetwork)
+			}
+		}
+
 		dataCenterJson := DataCenter{
 			Key:             dataCenter.Key,
 			Name:            dataCenter.Name,
@@ -660,17 +926,27 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 			State:           dataCenter.State,
 			Country:         dataCenter.Country,
 			GeoRegion:       dataCenter.GeoRegion,
+			Status:          dataCenter.Status,
+			ClosureDate:     dataCenter.ClosureDate,
+			FrontEndPublic:  frontEndPublicOutput,
+			LoadBalancerIPs: loadBalancerIPsOutput,
 			PrivateNetworks: pnsOutput,
 			ServiceNetwork:  serviceNetworkOutput,
 			SslVpn:          sslVpnsOutput,
+			SslVpnPops:      sslVpnPopsOutput,
 			Evault:          evaultOutput,
 			Icos:            icosOutput,
 			FileBlock:       fileblockOutput,
 			AdvMon:          advmonOutput,
 			RHELS:           rhelsOutput,
 			IMS:             imsOutput,
+			LegacyNetworks:  legacyNetworksOutput,
+			WindowsVsi:      windowsVsiOutput,
 			CidrNetworks:    cloudCidrNetworks,
 			Conflict:        dataCenterConflict,
+
+			PublicCidrNetworks: publicCidrNetworks,
+			PublicConflict:     publicConflict,
 		}
 
 		if len(pnsOutput) > 0 {
@@ -678,21 +954,7 @@ func runSubnetCalculator(requestedCidr string, selectedDataCenters []string) (Co
 		}
 	}
 
-	config := Config{
-		Name:                 viper.GetString("name"),
-		Type:                 viper.GetString("type"),
-		Version:              viper.GetString("version"),
-		LastUpdated:          viper.GetString("last_updated"),
-		ReleaseNotes:         viper.GetString("release_notes"),
-		Source:               viper.GetString("source"),
-		SourceJson:           viper.GetString("source_json"),
-		Issues:               viper.GetString("issues"),
-		RequestedCidr:        requestedCidr,
-		RequestedCidrNetwork: requestedCidrNetwork,
-		DataCenters:          dataCentersOutput,
-	}
-
-	return config, nil
+	return requestedCidrNetwork, dataCentersOutput
 }
 
 func CompareCidrNetworksV2(leftCidr string, rightCidr string) bool {
@@ -709,17 +971,17 @@ func CompareCidrNetworksV2(leftCidr string, rightCidr string) bool {
 	return leftPrefix.Overlaps(rightPrefix)
 }
 
-func readDataCenters(requestedCidr string, selectedDataCenters []string) (Config, error) {
-	var tmpConfig Config
-	file, _ := os.ReadFile("ip-ranges.json")
-
-	err := json.Unmarshal([]byte(file), &tmpConfig)
+func readDataCenters(requestedCidr string, selectedDataCenters []string, excludeClosing bool) (Config, error) {
+	tmpConfig, err := LoadConfig("ip-ranges.json")
 	if err != nil {
-		logger.ErrorLogger.Fatal(fmt.Sprintf("found an error: %v", err))
+		logger.ErrorLogger.Error("error loading the data set.", zap.String("error: ", err.Error()))
 		return Config{}, err
 	}
 
 	dataCenters := tmpConfig.DataCenters
+	if excludeClosing {
+		dataCenters = ExcludeClosing(dataCenters)
+	}
 
 	dataCentersFiltered := ApplyFilter(dataCenters, func(dataCenter DataCenter) bool {
 		return Contains(selectedDataCenters, strings.ToLower(dataCenter.Name))
@@ -752,40 +1014,70 @@ func readDataCenters(requestedCidr string, selectedDataCenters []string) (Config
 
 		eVaultOutput := []Evault{}
 		for _, eVault := range dataCenter.Evault {
-			eVaultJson := Evault{CidrBlocks: eVault.CidrBlocks}
+			eVaultJson := Evault{CidrBlocks: eVault.CidrBlocks, Flows: eVault.Flows}
 			eVaultOutput = append(eVaultOutput, eVaultJson)
 		}
 
 		fileBlockOutput := []FileBlock{}
 		for _, fileBlock := range dataCenter.FileBlock {
-			fileBlockJson := FileBlock{CidrBlocks: fileBlock.CidrBlocks}
+			fileBlockJson := FileBlock{CidrBlocks: fileBlock.CidrBlocks, Flows: fileBlock.Flows}
 			fileBlockOutput = append(fileBlockOutput, fileBlockJson)
 		}
 
 		icosOutput := []Icos{}
 		for _, icos := range dataCenter.Icos {
-			icosJson := Icos{CidrBlocks: icos.CidrBlocks}
+			icosJson := Icos{CidrBlocks: icos.CidrBlocks, Flows: icos.Flows}
 			icosOutput = append(icosOutput, icosJson)
 		}
 
 		advmonOutput := []AdvMon{}
 		for _, advMon := range dataCenter.AdvMon {
-			advmonJson := AdvMon{CidrBlocks: advMon.CidrBlocks}
+			advmonJson := AdvMon{CidrBlocks: advMon.CidrBlocks, Flows: advMon.Flows}
 			advmonOutput = append(advmonOutput, advmonJson)
 		}
 
 		rhelsOutput := []RHELS{}
 		for _, rhels := range dataCenter.RHELS {
-			rhelsJson := RHELS{CidrBlocks: rhels.CidrBlocks}
+			rhelsJson := RHELS{OriginDataCenter: rhels.OriginDataCenter, CidrBlocks: rhels.CidrBlocks}
 			rhelsOutput = append(rhelsOutput, rhelsJson)
 		}
 
 		imsOutput := []IMS{}
 		for _, ims := range dataCenter.IMS {
-			imsJson := IMS{CidrBlocks: ims.CidrBlocks}
+			imsJson := IMS{OriginDataCenter: ims.OriginDataCenter, CidrBlocks: ims.CidrBlocks}
 			imsOutput = append(imsOutput, imsJson)
 		}
 
+		legacyNetworksOutput := []LegacyNetwork{}
+		for _, legacyNetwork := range dataCenter.LegacyNetworks {
+			legacyNetworkJson := LegacyNetwork{CidrBlocks: legacyNetwork.CidrBlocks}
+			legacyNetworksOutput = append(legacyNetworksOutput, legacyNetworkJson)
+		}
+
+		windowsVsiOutput := []WindowsVsi{}
+		for _, windowsVsi := range dataCenter.WindowsVsi {
+			windowsVsiJson := WindowsVsi{CidrBlocks: windowsVsi.CidrBlocks}
+			windowsVsiOutput = append(windowsVsiOutput, windowsVsiJson)
+		}
+
+		sslVpnPopsOutput := []SslVpnPop{}
+		for _, sslVpnPop := range dataCenter.SslVpnPops {
+			sslVpnPopJson := SslVpnPop{CidrBlocks: sslVpnPop.CidrBlocks}
+			sslVpnPopsOutput = append(sslVpnPopsOutput, sslVpnPopJson)
+		}
+
+		frontEndPublicOutput := []FrontEndPublic{}
+		for _, frontEndPublic := range dataCenter.FrontEndPublic {
+			frontEndPublicJson := FrontEndPublic{CidrBlocks: frontEndPublic.CidrBlocks}
+			frontEndPublicOutput = append(frontEndPublicOutput, frontEndPublicJson)
+		}
+
+		loadBalancerIPsOutput := []LoadBalancerIP{}
+		for _, loadBalancerIP := range dataCenter.LoadBalancerIPs {
+			loadBalancerIPJson := LoadBalancerIP{CidrBlocks: loadBalancerIP.CidrBlocks}
+			loadBalancerIPsOutput = append(loadBalancerIPsOutput, loadBalancerIPJson)
+		}
+
 		dataCenterJson := DataCenter{
 			Key:             dataCenter.Key,
 			Name:            dataCenter.Name,
@@ -793,15 +1085,22 @@ func readDataCenters(requestedCidr string, selectedDataCenters []string) (Config
 			State:           dataCenter.State,
 			Country:         dataCenter.Country,
 			GeoRegion:       dataCenter.GeoRegion,
+			Status:          dataCenter.Status,
+			ClosureDate:     dataCenter.ClosureDate,
+			FrontEndPublic:  frontEndPublicOutput,
+			LoadBalancerIPs: loadBalancerIPsOutput,
 			PrivateNetworks: pnsOutput,
 			ServiceNetwork:  serviceNetworkOutput,
 			SslVpn:          sslVpnsOutput,
+			SslVpnPops:      sslVpnPopsOutput,
 			Evault:          eVaultOutput,
 			FileBlock:       fileBlockOutput,
 			Icos:            icosOutput,
 			AdvMon:          advmonOutput,
 			RHELS:           rhelsOutput,
 			IMS:             imsOutput,
+			LegacyNetworks:  legacyNetworksOutput,
+			WindowsVsi:      windowsVsiOutput,
 			Conflict:        conflict,
 		}
 
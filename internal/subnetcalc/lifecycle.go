@@ -0,0 +1,65 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package subnetcalc
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lifecycle status of a data center. An empty status is active.
+const (
+	StatusActive  = "active"
+	StatusClosing = "closing"
+	StatusClosed  = "closed"
+)
+
+// ClosureDateLayout is the layout of DataCenter.ClosureDate.
+const ClosureDateLayout = "2006-01-02"
+
+// CheckLifecycle reports an unknown status or a closure date that does not parse.
+// A closing data center needs a closure date.
+func CheckLifecycle(status string, closureDate string) error {
+	switch status {
+	case "", StatusActive, StatusClosed:
+	case StatusClosing:
+		if closureDate == "" {
+			return fmt.Errorf("a closing data center needs a closure_date")
+		}
+	default:
+		return fmt.Errorf("unknown status %q, expected %s, %s or %s", status, StatusActive, StatusClosing, StatusClosed)
+	}
+
+	if closureDate != "" {
+		if _, err := time.Parse(ClosureDateLayout, closureDate); err != nil {
+			return fmt.Errorf("closure_date %q is not a %s date", closureDate, ClosureDateLayout)
+		}
+	}
+	return nil
+}
+
+// Closing reports whether the data center is closing or already closed.
+func (dc DataCenter) Closing() bool {
+	return dc.Status == StatusClosing || dc.Status == StatusClosed
+}
+
+// ExcludeClosing returns the data centers that are not closing or closed.
+func ExcludeClosing(dataCenters []DataCenter) []DataCenter {
+	return ApplyFilter(dataCenters, func(dataCenter DataCenter) bool {
+		return !dataCenter.Closing()
+	})
+}
@@ -0,0 +1,399 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package subnetcalc
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+type ReportFormat string
+
+const (
+	ReportJSON     ReportFormat = "json"
+	ReportMarkdown ReportFormat = "markdown"
+	ReportText     ReportFormat = "text"
+	ReportHTML     ReportFormat = "html"
+)
+
+// ContentType returns the HTTP content type used when serving the format.
+func (f ReportFormat) ContentType() string {
+	switch f {
+	case ReportMarkdown:
+		return "text/markdown; charset=utf-8"
+	case ReportText:
+		return "text/plain; charset=utf-8"
+	case ReportHTML:
+		return "text/html; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+// ParseReportFormat maps a format name such as "md" or "html" to a ReportFormat.
+func ParseReportFormat(format string) (ReportFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "json":
+		return ReportJSON, nil
+	case "markdown", "md":
+		return ReportMarkdown, nil
+	case "text", "txt", "plain":
+		return ReportText, nil
+	case "html":
+		return ReportHTML, nil
+	}
+	return "", fmt.Errorf("unsupported report format %q", format)
+}
+
+// NegotiateReportFormat picks the report format from an explicit format parameter,
+// falling back to the first media type of the Accept header that maps to a format.
+func NegotiateReportFormat(format string, accept string) (ReportFormat, error) {
+	if format != "" {
+		return ParseReportFormat(format)
+	}
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(mediaRange, ";")[0]))
+		switch mediaType {
+		case "application/json", "*/*":
+			return ReportJSON, nil
+		case "text/markdown", "text/x-markdown":
+			return ReportMarkdown, nil
+		case "text/plain":
+			return ReportText, nil
+		case "text/html":
+			return ReportHTML, nil
+		}
+	}
+
+	return ReportJSON, nil
+}
+
+type Report struct {
+	Name                 string                `json:"name"`
+	Version              string                `json:"version"`
+	LastUpdated          string                `json:"last_updated"`
+	Source               string                `json:"source"`
+	RequestedCidrNetwork CidrNetwork           `json:"requested_cidr_network"`
+	Summary              ReportSummary         `json:"summary"`
+	DataCenters          []ReportDataCenter    `json:"data_centers"`
+	Services             []ReportService       `json:"services"`
+	Conflicts            []ReportConflictEntry `json:"conflicts"`
+	PublicConflicts      []ReportConflictEntry `json:"public_conflicts"`
+}
+
+type ReportSummary struct {
+	DataCentersChecked    int `json:"data_centers_checked"`
+	DataCentersInConflict int `json:"data_centers_in_conflict"`
+	CidrsChecked          int `json:"cidrs_checked"`
+	CidrsInConflict       int `json:"cidrs_in_conflict"`
+	PublicCidrsChecked    int `json:"public_cidrs_checked"`
+	PublicCidrsInConflict int `json:"public_cidrs_in_conflict"`
+	// ClosingDataCenters are the checked data centers that are closing or closed.
+	ClosingDataCenters []string `json:"closing_data_centers"`
+}
+
+type ReportDataCenter struct {
+	Name            string   `json:"name"`
+	City            string   `json:"city"`
+	Country         string   `json:"country"`
+	GeoRegion       string   `json:"geo_region"`
+	Status          string   `json:"status,omitempty"`
+	ClosureDate     string   `json:"closure_date,omitempty"`
+	CidrsInConflict int      `json:"cidrs_in_conflict"`
+	Services        []string `json:"services"`
+}
+
+type ReportService struct {
+	Service         string   `json:"service"`
+	DataCenters     []string `json:"data_centers"`
+	CidrsInConflict int      `json:"cidrs_in_conflict"`
+}
+
+type ReportConflictEntry struct {
+	DataCenter string `json:"data_center"`
+	CidrNetwork
+}
+
+// NewReport summarizes the conflicts found by the calculator in config.
+func NewReport(config Config) Report {
+	report := Report{
+		Name:                 config.Name,
+		Version:              config.Version,
+		LastUpdated:          config.LastUpdated,
+		Source:               config.Source,
+		RequestedCidrNetwork: config.RequestedCidrNetwork,
+		DataCenters:          []ReportDataCenter{},
+		Services:             []ReportService{},
+		Conflicts:            []ReportConflictEntry{},
+		PublicConflicts:      []ReportConflictEntry{},
+		Summary:              ReportSummary{ClosingDataCenters: []string{}},
+	}
+
+	if report.RequestedCidrNetwork.CidrNotation == "" {
+		report.RequestedCidrNetwork.CidrNotation = config.RequestedCidr
+	}
+
+	services := map[string]*ReportService{}
+	serviceNames := []string{}
+
+	for _, dataCenter := range config.DataCenters {
+		report.Summary.DataCentersChecked++
+		report.Summary.CidrsChecked += len(dataCenter.CidrNetworks)
+		report.Summary.PublicCidrsChecked += len(dataCenter.PublicCidrNetworks)
+		if dataCenter.Closing() {
+			report.Summary.ClosingDataCenters = append(report.Summary.ClosingDataCenters, dataCenter.Name)
+		}
+
+		for _, cidrNetwork := range dataCenter.PublicCidrNetworks {
+			if cidrNetwork.Conflict {
+				report.Summary.PublicCidrsInConflict++
+				report.PublicConflicts = append(report.PublicConflicts, ReportConflictEntry{
+					DataCenter:  dataCenter.Name,
+					CidrNetwork: cidrNetwork,
+				})
+			}
+		}
+
+		if !dataCenter.Conflict {
+			continue
+		}
+		report.Summary.DataCentersInConflict++
+
+		reportDataCenter := ReportDataCenter{
+			Name:        dataCenter.Name,
+			City:        dataCenter.City,
+			Country:     dataCenter.Country,
+			GeoRegion:   dataCenter.GeoRegion,
+			Status:      dataCenter.Status,
+			ClosureDate: dataCenter.ClosureDate,
+			Services:    []string{},
+		}
+
+		for _, cidrNetwork := range dataCenter.CidrNetworks {
+			if !cidrNetwork.Conflict {
+				continue
+			}
+
+			report.Summary.CidrsInConflict++
+			reportDataCenter.CidrsInConflict++
+			report.Conflicts = append(report.Conflicts, ReportConflictEntry{
+				DataCenter:  dataCenter.Name,
+				CidrNetwork: cidrNetwork,
+			})
+
+			if !containsString(reportDataCenter.Services, cidrNetwork.Service) {
+				reportDataCenter.Services = append(reportDataCenter.Services, cidrNetwork.Service)
+			}
+
+			service, ok := services[cidrNetwork.Service]
+			if !ok {
+				service = &ReportService{Service: cidrNetwork.Service, DataCenters: []string{}}
+				services[cidrNetwork.Service] = service
+				serviceNames = append(serviceNames, cidrNetwork.Service)
+			}
+			service.CidrsInConflict++
+			if !containsString(service.DataCenters, dataCenter.Name) {
+				service.DataCenters = append(service.DataCenters, dataCenter.Name)
+			}
+		}
+
+		report.DataCenters = append(report.DataCenters, reportDataCenter)
+	}
+
+	sort.Strings(serviceNames)
+	for _, name := range serviceNames {
+		report.Services = append(report.Services, *services[name])
+	}
+
+	return report
+}
+
+// Render writes the report to w in the requested format.
+func (r Report) Render(w io.Writer, format ReportFormat) error {
+	switch format {
+	case ReportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case ReportMarkdown:
+		return markdownReportTemplate.Execute(w, r)
+	case ReportText:
+		return textReportTemplate.Execute(w, r)
+	case ReportHTML:
+		return htmlReportTemplate.Execute(w, r)
+	}
+	return fmt.Errorf("unsupported report format %q", format)
+}
+
+// Lifecycle describes a closing or closed data center, such as "closing
+// 2024-10-31". It is empty for an active data center.
+func (dc ReportDataCenter) Lifecycle() string {
+	if dc.Status == "" || dc.Status == StatusActive {
+		return ""
+	}
+	if dc.ClosureDate == "" {
+		return dc.Status
+	}
+	return dc.Status + " " + dc.ClosureDate
+}
+
+func containsString(s []string, str string) bool {
+	for _, v := range s {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
+
+var reportFuncs = map[string]interface{}{
+	"join": strings.Join,
+	"pad": func(width int, value interface{}) string {
+		return fmt.Sprintf("%-*v", width, value)
+	},
+}
+
+var markdownReportTemplate = texttemplate.Must(texttemplate.New("markdown").Funcs(reportFuncs).Parse(`# CIDR conflict report for {{ .RequestedCidrNetwork.CidrNotation }}
+
+## Summary
+
+| | |
+|---|---|
+| Requested CIDR | ` + "`{{ .RequestedCidrNetwork.CidrNotation }}`" + ` |
+| Address range | {{ .RequestedCidrNetwork.NetworkAddress }} - {{ .RequestedCidrNetwork.BroadcastAddress }} |
+| Data centers checked | {{ .Summary.DataCentersChecked }} |
+| Data centers in conflict | {{ .Summary.DataCentersInConflict }} |
+| IBM Cloud CIDRs in conflict | {{ .Summary.CidrsInConflict }} of {{ .Summary.CidrsChecked }} |
+| Data set | {{ .Name }} {{ .Version }} ({{ .LastUpdated }}) |
+{{ if .Summary.ClosingDataCenters }}| Closing or closed data centers | {{ join .Summary.ClosingDataCenters ", " }} |
+{{ end }}{{ if not .Conflicts }}
+No conflicts were found with the IBM Cloud IP ranges.
+{{ else }}
+## Conflicts by data center
+
+| Data center | City | Country | Geo region | Status | Conflicting CIDRs | Services |
+|---|---|---|---|---|---|---|
+{{ range .DataCenters }}| {{ .Name }} | {{ .City }} | {{ .Country }} | {{ .GeoRegion }} | {{ .Lifecycle }} | {{ .CidrsInConflict }} | {{ join .Services ", " }} |
+{{ end }}
+## Affected services
+
+| Service | Conflicting CIDRs | Data centers |
+|---|---|---|
+{{ range .Services }}| {{ .Service }} | {{ .CidrsInConflict }} | {{ join .DataCenters ", " }} |
+{{ end }}
+## Conflicting IBM Cloud CIDRs
+
+| Data center | Service | CIDR | Subnet mask | First host | Last host | Assignable hosts |
+|---|---|---|---|---|---|---|
+{{ range .Conflicts }}| {{ .DataCenter }} | {{ .Service }} | ` + "`{{ .CidrNotation }}`" + ` | {{ .SubnetMask }} | {{ .FirstAssignableHost }} | {{ .LastAssignableHost }} | {{ .AssignableHosts }} |
+{{ end }}{{ end }}{{ if .PublicConflicts }}
+## Overlapping public ranges
+
+| Data center | Service | CIDR | First host | Last host |
+|---|---|---|---|---|
+{{ range .PublicConflicts }}| {{ .DataCenter }} | {{ .Service }} | ` + "`{{ .CidrNotation }}`" + ` | {{ .FirstAssignableHost }} | {{ .LastAssignableHost }} |
+{{ end }}{{ end }}`))
+
+var textReportTemplate = texttemplate.Must(texttemplate.New("text").Funcs(reportFuncs).Parse(`CIDR conflict report for {{ .RequestedCidrNetwork.CidrNotation }}
+
+SUMMARY
+  Requested CIDR:              {{ .RequestedCidrNetwork.CidrNotation }}
+  Address range:               {{ .RequestedCidrNetwork.NetworkAddress }} - {{ .RequestedCidrNetwork.BroadcastAddress }}
+  Data centers checked:        {{ .Summary.DataCentersChecked }}
+  Data centers in conflict:    {{ .Summary.DataCentersInConflict }}
+  IBM Cloud CIDRs in conflict: {{ .Summary.CidrsInConflict }} of {{ .Summary.CidrsChecked }}
+  Data set:                    {{ .Name }} {{ .Version }} ({{ .LastUpdated }})
+{{ if .Summary.ClosingDataCenters }}  Closing or closed:           {{ join .Summary.ClosingDataCenters ", " }}
+{{ end }}{{ if not .Conflicts }}
+No conflicts were found with the IBM Cloud IP ranges.
+{{ else }}
+CONFLICTS BY DATA CENTER
+  {{ pad 12 "DATA CENTER" }} {{ pad 16 "CITY" }} {{ pad 14 "GEO REGION" }} {{ pad 18 "STATUS" }} {{ pad 6 "CIDRS" }} SERVICES
+{{ range .DataCenters }}  {{ pad 12 .Name }} {{ pad 16 .City }} {{ pad 14 .GeoRegion }} {{ pad 18 .Lifecycle }} {{ pad 6 .CidrsInConflict }} {{ join .Services ", " }}
+{{ end }}
+AFFECTED SERVICES
+  {{ pad 18 "SERVICE" }} {{ pad 6 "CIDRS" }} DATA CENTERS
+{{ range .Services }}  {{ pad 18 .Service }} {{ pad 6 .CidrsInConflict }} {{ join .DataCenters ", " }}
+{{ end }}
+CONFLICTING IBM CLOUD CIDRS
+  {{ pad 12 "DATA CENTER" }} {{ pad 18 "SERVICE" }} {{ pad 20 "CIDR" }} {{ pad 16 "SUBNET MASK" }} {{ pad 16 "FIRST HOST" }} {{ pad 16 "LAST HOST" }} HOSTS
+{{ range .Conflicts }}  {{ pad 12 .DataCenter }} {{ pad 18 .Service }} {{ pad 20 .CidrNotation }} {{ pad 16 .SubnetMask }} {{ pad 16 .FirstAssignableHost }} {{ pad 16 .LastAssignableHost }} {{ .AssignableHosts }}
+{{ end }}{{ end }}{{ if .PublicConflicts }}
+OVERLAPPING PUBLIC RANGES
+  {{ pad 12 "DATA CENTER" }} {{ pad 26 "SERVICE" }} {{ pad 20 "CIDR" }} {{ pad 16 "FIRST HOST" }} LAST HOST
+{{ range .PublicConflicts }}  {{ pad 12 .DataCenter }} {{ pad 26 .Service }} {{ pad 20 .CidrNotation }} {{ pad 16 .FirstAssignableHost }} {{ .LastAssignableHost }}
+{{ end }}{{ end }}`))
+
+var htmlReportTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(reportFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>CIDR conflict report for {{ .RequestedCidrNetwork.CidrNotation }}</title>
+</head>
+<body>
+<h1>CIDR conflict report for {{ .RequestedCidrNetwork.CidrNotation }}</h1>
+<h2>Summary</h2>
+<table>
+<tr><th>Requested CIDR</th><td><code>{{ .RequestedCidrNetwork.CidrNotation }}</code></td></tr>
+<tr><th>Address range</th><td>{{ .RequestedCidrNetwork.NetworkAddress }} - {{ .RequestedCidrNetwork.BroadcastAddress }}</td></tr>
+<tr><th>Data centers checked</th><td>{{ .Summary.DataCentersChecked }}</td></tr>
+<tr><th>Data centers in conflict</th><td>{{ .Summary.DataCentersInConflict }}</td></tr>
+<tr><th>IBM Cloud CIDRs in conflict</th><td>{{ .Summary.CidrsInConflict }} of {{ .Summary.CidrsChecked }}</td></tr>
+<tr><th>Data set</th><td>{{ .Name }} {{ .Version }} ({{ .LastUpdated }})</td></tr>
+{{ if .Summary.ClosingDataCenters }}<tr><th>Closing or closed data centers</th><td>{{ join .Summary.ClosingDataCenters ", " }}</td></tr>
+{{ end }}</table>
+{{ if not .Conflicts }}
+<p>No conflicts were found with the IBM Cloud IP ranges.</p>
+{{ else }}
+<h2>Conflicts by data center</h2>
+<table>
+<thead><tr><th>Data center</th><th>City</th><th>Country</th><th>Geo region</th><th>Status</th><th>Conflicting CIDRs</th><th>Services</th></tr></thead>
+<tbody>
+{{ range .DataCenters }}<tr><td>{{ .Name }}</td><td>{{ .City }}</td><td>{{ .Country }}</td><td>{{ .GeoRegion }}</td><td>{{ .Lifecycle }}</td><td>{{ .CidrsInConflict }}</td><td>{{ join .Services ", " }}</td></tr>
+{{ end }}</tbody>
+</table>
+<h2>Affected services</h2>
+<table>
+<thead><tr><th>Service</th><th>Conflicting CIDRs</th><th>Data centers</th></tr></thead>
+<tbody>
+{{ range .Services }}<tr><td>{{ .Service }}</td><td>{{ .CidrsInConflict }}</td><td>{{ join .DataCenters ", " }}</td></tr>
+{{ end }}</tbody>
+</table>
+<h2>Conflicting IBM Cloud CIDRs</h2>
+<table>
+<thead><tr><th>Data center</th><th>Service</th><th>CIDR</th><th>Subnet mask</th><th>First host</th><th>Last host</th><th>Assignable hosts</th></tr></thead>
+<tbody>
+{{ range .Conflicts }}<tr><td>{{ .DataCenter }}</td><td>{{ .Service }}</td><td><code>{{ .CidrNotation }}</code></td><td>{{ .SubnetMask }}</td><td>{{ .FirstAssignableHost }}</td><td>{{ .LastAssignableHost }}</td><td>{{ .AssignableHosts }}</td></tr>
+{{ end }}</tbody>
+</table>
+{{ end }}{{ if .PublicConflicts }}
+<h2>Overlapping public ranges</h2>
+<table>
+<thead><tr><th>Data center</th><th>Service</th><th>CIDR</th><th>First host</th><th>Last host</th></tr></thead>
+<tbody>
+{{ range .PublicConflicts }}<tr><td>{{ .DataCenter }}</td><td>{{ .Service }}</td><td><code>{{ .CidrNotation }}</code></td><td>{{ .FirstAssignableHost }}</td><td>{{ .LastAssignableHost }}</td></tr>
+{{ end }}</tbody>
+</table>
+{{ end }}
+</body>
+</html>
+`))
@@ -0,0 +1,255 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package subnetcalc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The data set format. A data set with the same major schema version can be
+// read, newer minor versions only add fields. SchemaURL is the published JSON
+// Schema, data/datacenters.schema.json.
+const (
+	DatasetType   = "classic_data_center_cidr"
+	SchemaVersion = "3.4.0"
+	SchemaURL     = "https://raw.githubusercontent.com/dprosper/cidr-calculator/main/data/datacenters.schema.json"
+)
+
+// legacySchemaVersion is assumed for data sets written before the version field.
+const legacySchemaVersion = "3.0.0"
+
+// schemaVersion is a parsed major.minor.patch version.
+type schemaVersion [3]int
+
+func parseSchemaVersion(version string) (schemaVersion, error) {
+	var parsed schemaVersion
+
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) > 3 {
+		return parsed, fmt.Errorf("invalid schema version %q", version)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, fmt.Errorf("invalid schema version %q", version)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+func (v schemaVersion) less(other schemaVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+// migration upgrades a data set decoded as a generic map to version to.
+type migration struct {
+	to      string
+	migrate func(dataset map[string]interface{}) error
+}
+
+// migrations are applied in order to data sets older than their version.
+var migrations = []migration{
+	// 3.0.2 dropped the request of the calculator run the data set was
+	// generated with.
+	{to: "3.0.2", migrate: func(dataset map[string]interface{}) error {
+		delete(dataset, "requested_cidr")
+		delete(dataset, "requested_cidr_network")
+		return nil
+	}},
+}
+
+// MigrateDataset checks the schema version of a published data set and returns
+// it in the shape of SchemaVersion. The 2022 ibm-cloud-data-centers metadata
+// files, a map of data center to location, are turned into a data set without
+// networks. Data sets of another major version or type are rejected.
+func MigrateDataset(data []byte) ([]byte, error) {
+	var dataset map[string]interface{}
+	if err := json.Unmarshal(data, &dataset); err != nil {
+		return nil, fmt.Errorf("data set is not a JSON object: %w", err)
+	}
+
+	if _, ok := dataset["data_centers"]; !ok {
+		metadata, ok := metadataDataset(dataset)
+		if !ok {
+			return nil, fmt.Errorf("data set has no data_centers")
+		}
+		dataset = metadata
+	}
+
+	version, err := datasetSchemaVersion(dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _ := parseSchemaVersion(SchemaVersion)
+	parsed, err := parseSchemaVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if parsed[0] > current[0] {
+		return nil, fmt.Errorf("data set schema version %s is newer than the supported version %s, update the calculator", version, SchemaVersion)
+	}
+	if parsed[0] < current[0] {
+		return nil, fmt.Errorf("data set schema version %s is not supported, the calculator reads %d.x data sets", version, current[0])
+	}
+
+	if datasetType, _ := dataset["type"].(string); datasetType != "" && datasetType != DatasetType {
+		return nil, fmt.Errorf("data set type %q is not supported, expected %q", datasetType, DatasetType)
+	}
+
+	for _, m := range migrations {
+		to, _ := parseSchemaVersion(m.to)
+		if !parsed.less(to) {
+			continue
+		}
+		if err := m.migrate(dataset); err != nil {
+			return nil, fmt.Errorf("error migrating data set from schema version %s to %s: %w", version, m.to, err)
+		}
+	}
+
+	if err := checkDataCenters(dataset["data_centers"]); err != nil {
+		return nil, err
+	}
+
+	// 3.1.0 added $schema and schema_version.
+	dataset["type"] = DatasetType
+	if parsed.less(current) {
+		dataset["$schema"] = SchemaURL
+		dataset["schema_version"] = SchemaVersion
+		dataset["version"] = SchemaVersion
+	}
+
+	return json.Marshal(dataset)
+}
+
+// datasetSchemaVersion returns schema_version, or version for data sets
+// written before 3.1.0 where it held the format version.
+func datasetSchemaVersion(dataset map[string]interface{}) (string, error) {
+	for _, field := range []string{"schema_version", "version"} {
+		value, ok := dataset[field]
+		if !ok || value == nil {
+			continue
+		}
+		version, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("data set %s must be a string, got %v", field, value)
+		}
+		if version != "" {
+			return version, nil
+		}
+	}
+	return legacySchemaVersion, nil
+}
+
+// metadataDataset turns a metadata file of the backend job into a data set.
+func metadataDataset(metadata map[string]interface{}) (map[string]interface{}, bool) {
+	if len(metadata) == 0 {
+		return nil, false
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		location, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if _, ok := location["geo_region"]; !ok {
+			return nil, false
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dataCenters := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		location := metadata[key].(map[string]interface{})
+		dataCenter := map[string]interface{}{"key": key, "name": key}
+		for _, field := range []string{"city", "state", "country", "geo_region"} {
+			if value, ok := location[field]; ok {
+				dataCenter[field] = value
+			}
+		}
+		dataCenters = append(dataCenters, dataCenter)
+	}
+
+	return map[string]interface{}{
+		"name":         "IBM Cloud data centers",
+		"type":         DatasetType,
+		"version":      legacySchemaVersion,
+		"data_centers": dataCenters,
+	}, true
+}
+
+// checkDataCenters rejects data centers json.Unmarshal would silently read as
+// zero values.
+func checkDataCenters(value interface{}) error {
+	dataCenters, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("data set data_centers must be an array")
+	}
+
+	for i, value := range dataCenters {
+		dataCenter, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("data center %d must be an object", i)
+		}
+		key, _ := dataCenter["key"].(string)
+		name, _ := dataCenter["name"].(string)
+		if key == "" && name == "" {
+			return fmt.Errorf("data center %d has no key or name", i)
+		}
+		if key == "" {
+			dataCenter["key"] = name
+		}
+		if name == "" {
+			dataCenter["name"] = key
+		}
+
+		for field, value := range dataCenter {
+			blocks, ok := value.([]interface{})
+			if !ok || field == "cidr_networks" || field == "public_cidr_networks" {
+				continue
+			}
+			for _, block := range blocks {
+				if _, ok := block.(map[string]interface{}); !ok {
+					return fmt.Errorf("data center %s: %s must be an array of objects with cidr_blocks", dataCenter["key"], field)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// DecodeDataset migrates data with MigrateDataset and decodes it into v, such
+// as a Config.
+func DecodeDataset(data []byte, v interface{}) error {
+	migrated, err := MigrateDataset(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(migrated, v)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package subnetcalc
+
+// ServiceBlock is one list of CIDR blocks of a data center together with the
+// service it belongs to. Key is the pod (BCR) for private networks. Public is set
+// for the front-end and load balancer ranges. Flows are the required flows of
+// the service, when ips.md lists them.
+type ServiceBlock struct {
+	Service    string
+	Key        string
+	CidrBlocks []string
+	Public     bool
+	Flows      []Flow
+}
+
+// Service labels, as used in CidrNetwork.Service.
+const (
+	ServicePrivateNetwork = "Private Network"
+	ServiceServiceNetwork = "Service Network"
+	ServiceSslVpn         = "SSL VPN"
+	ServiceSslVpnPop      = "SSL VPN PoP"
+	ServiceFrontEndPublic = "Front-end Public Network"
+	ServiceLoadBalancer   = "Load Balancer"
+	ServiceEvault         = "eVault"
+	ServiceIcos           = "ICOS"
+	ServiceFileBlock      = "File & Block"
+	ServiceAdvMon         = "AdvMon (Nimsoft)"
+	ServiceRHELS          = "RHEL"
+	ServiceIMS            = "IMS"
+	ServiceLegacyNetwork  = "Legacy Network"
+	ServiceWindowsVsi     = "Windows VSI"
+)
+
+// ServiceBlocks lists every CIDR block list of the data center in the order the
+// calculator checks them.
+func (dc DataCenter) ServiceBlocks() []ServiceBlock {
+	blocks := []ServiceBlock{}
+
+	for _, pn := range dc.PrivateNetworks {
+		blocks = append(blocks, ServiceBlock{Service: ServicePrivateNetwork, Key: pn.Key, CidrBlocks: pn.CidrBlocks})
+	}
+	for _, service := range dc.ServiceNetwork {
+		blocks = append(blocks, ServiceBlock{Service: ServiceServiceNetwork, CidrBlocks: service.CidrBlocks})
+	}
+	for _, sslVpn := range dc.SslVpn {
+		blocks = append(blocks, ServiceBlock{Service: ServiceSslVpn, CidrBlocks: sslVpn.CidrBlocks})
+	}
+	for _, sslVpnPop := range dc.SslVpnPops {
+		blocks = append(blocks, ServiceBlock{Service: ServiceSslVpnPop, CidrBlocks: sslVpnPop.CidrBlocks})
+	}
+	for _, evault := range dc.Evault {
+		blocks = append(blocks, ServiceBlock{Service: ServiceEvault, CidrBlocks: evault.CidrBlocks, Flows: evault.Flows})
+	}
+	for _, icos := range dc.Icos {
+		blocks = append(blocks, ServiceBlock{Service: ServiceIcos, CidrBlocks: icos.CidrBlocks, Flows: icos.Flows})
+	}
+	for _, fileBlock := range dc.FileBlock {
+		blocks = append(blocks, ServiceBlock{Service: ServiceFileBlock, CidrBlocks: fileBlock.CidrBlocks, Flows: fileBlock.Flows})
+	}
+	for _, advMon := range dc.AdvMon {
+		blocks = append(blocks, ServiceBlock{Service: ServiceAdvMon, CidrBlocks: advMon.CidrBlocks, Flows: advMon.Flows})
+	}
+	for _, rhels := range dc.RHELS {
+		blocks = append(blocks, ServiceBlock{Service: ServiceRHELS, CidrBlocks: rhels.CidrBlocks})
+	}
+	for _, ims := range dc.IMS {
+		blocks = append(blocks, ServiceBlock{Service: ServiceIMS, CidrBlocks: ims.CidrBlocks})
+	}
+	for _, legacyNetwork := range dc.LegacyNetworks {
+		blocks = append(blocks, ServiceBlock{Service: ServiceLegacyNetwork, CidrBlocks: legacyNetwork.CidrBlocks})
+	}
+	for _, windowsVsi := range dc.WindowsVsi {
+		blocks = append(blocks, ServiceBlock{Service: ServiceWindowsVsi, CidrBlocks: windowsVsi.CidrBlocks})
+	}
+	for _, frontEndPublic := range dc.FrontEndPublic {
+		blocks = append(blocks, ServiceBlock{Service: ServiceFrontEndPublic, CidrBlocks: frontEndPublic.CidrBlocks, Public: true})
+	}
+	for _, loadBalancerIP := range dc.LoadBalancerIPs {
+		blocks = append(blocks, ServiceBlock{Service: ServiceLoadBalancer, CidrBlocks: loadBalancerIP.CidrBlocks, Public: true})
+	}
+
+	return blocks
+}
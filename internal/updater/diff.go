@@ -0,0 +1,443 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"dprosper/calculator/internal/subnetcalc"
+)
+
+// DatasetDiff is the semantic difference between two versions of the data set.
+type DatasetDiff struct {
+	From               string           `json:"from"`
+	To                 string           `json:"to"`
+	DataCentersAdded   []string         `json:"data_centers_added"`
+	DataCentersRemoved []string         `json:"data_centers_removed"`
+	CidrChanges        []CidrChange     `json:"cidr_changes"`
+	MetadataChanges    []MetadataChange `json:"metadata_changes"`
+	FlowChanges        []FlowChange     `json:"flow_changes"`
+}
+
+// CidrChange lists the CIDR blocks added to and removed from a service of a
+// data center. Pod is set for private networks.
+type CidrChange struct {
+	DataCenter string   `json:"data_center"`
+	Service    string   `json:"service"`
+	Pod        string   `json:"pod,omitempty"`
+	Added      []string `json:"added"`
+	Removed    []string `json:"removed"`
+}
+
+// MetadataChange is a changed city, state, country, geo region, status or
+// closure date of a data center.
+type MetadataChange struct {
+	DataCenter string `json:"data_center"`
+	Field      string `json:"field"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+// FlowChange lists the required flows added to and removed from a service of a
+// data center, as in "outbound tcp 443".
+type FlowChange struct {
+	DataCenter string   `json:"data_center"`
+	Service    string   `json:"service"`
+	Added      []string `json:"added"`
+	Removed    []string `json:"removed"`
+}
+
+type serviceKey struct {
+	service string
+	pod     string
+}
+
+// DiffIPRanges compares two versions of the data set.
+func DiffIPRanges(previous ICIPRanges, current ICIPRanges) DatasetDiff {
+	diff := DatasetDiff{
+		From:               previous.LastUpdated,
+		To:                 current.LastUpdated,
+		DataCentersAdded:   []string{},
+		DataCentersRemoved: []string{},
+		CidrChanges:        []CidrChange{},
+		MetadataChanges:    []MetadataChange{},
+		FlowChanges:        []FlowChange{},
+	}
+
+	previousDataCenters := dataCentersByName(previous.DataCenters)
+	currentDataCenters := dataCentersByName(current.DataCenters)
+
+	for _, name := range unionKeys(previousDataCenters, currentDataCenters) {
+		before, inPrevious := previousDataCenters[name]
+		after, inCurrent := currentDataCenters[name]
+
+		switch {
+		case !inPrevious:
+			diff.DataCentersAdded = append(diff.DataCentersAdded, name)
+		case !inCurrent:
+			diff.DataCentersRemoved = append(diff.DataCentersRemoved, name)
+		default:
+			diff.MetadataChanges = append(diff.MetadataChanges, metadataChanges(before, after)...)
+			diff.FlowChanges = append(diff.FlowChanges, flowChanges(name, before, after)...)
+		}
+
+		diff.CidrChanges = append(diff.CidrChanges, cidrChanges(name, before, after)...)
+	}
+
+	return diff
+}
+
+// Empty reports whether the two versions hold the same data.
+func (d DatasetDiff) Empty() bool {
+	return len(d.DataCentersAdded) == 0 && len(d.DataCentersRemoved) == 0 && len(d.CidrChanges) == 0 && len(d.MetadataChanges) == 0 && len(d.FlowChanges) == 0
+}
+
+// Filter returns the part of the diff about dataCenters and services. The data
+// center filter applies to every change, the service filter to CIDR and flow
+// changes only. An empty filter keeps everything. Names are compared case-insensitively.
+func (d DatasetDiff) Filter(dataCenters []string, services []string) DatasetDiff {
+	filtered := DatasetDiff{
+		From:               d.From,
+		To:                 d.To,
+		DataCentersAdded:   []string{},
+		DataCentersRemoved: []string{},
+		CidrChanges:        []CidrChange{},
+		MetadataChanges:    []MetadataChange{},
+		FlowChanges:        []FlowChange{},
+	}
+
+	for _, name := range d.DataCentersAdded {
+		if matches(dataCenters, name) {
+			filtered.DataCentersAdded = append(filtered.DataCentersAdded, name)
+		}
+	}
+	for _, name := range d.DataCentersRemoved {
+		if matches(dataCenters, name) {
+			filtered.DataCentersRemoved = append(filtered.DataCentersRemoved, name)
+		}
+	}
+	for _, change := range d.CidrChanges {
+		if matches(dataCenters, change.DataCenter) && matches(services, change.Service) {
+			filtered.CidrChanges = append(filtered.CidrChanges, change)
+		}
+	}
+	for _, change := range d.MetadataChanges {
+		if matches(dataCenters, change.DataCenter) {
+			filtered.MetadataChanges = append(filtered.MetadataChanges, change)
+		}
+	}
+	for _, change := range d.FlowChanges {
+		if matches(dataCenters, change.DataCenter) && matches(services, change.Service) {
+			filtered.FlowChanges = append(filtered.FlowChanges, change)
+		}
+	}
+
+	return filtered
+}
+
+func matches(filter []string, value string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, item := range filter {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// AffectedDataCenters returns the sorted data centers that were added, removed
+// or changed.
+func (d DatasetDiff) AffectedDataCenters() []string {
+	affected := map[string]bool{}
+	for _, name := range append(append([]string{}, d.DataCentersAdded...), d.DataCentersRemoved...) {
+		affected[name] = true
+	}
+	for _, change := range d.CidrChanges {
+		affected[change.DataCenter] = true
+	}
+	for _, change := range d.MetadataChanges {
+		affected[change.DataCenter] = true
+	}
+	for _, change := range d.FlowChanges {
+		affected[change.DataCenter] = true
+	}
+	return sortedKeys(affected)
+}
+
+// AffectedServices returns the sorted services with CIDR blocks or required
+// flows added or removed.
+func (d DatasetDiff) AffectedServices() []string {
+	affected := map[string]bool{}
+	for _, change := range d.CidrChanges {
+		affected[change.Service] = true
+	}
+	for _, change := range d.FlowChanges {
+		affected[change.Service] = true
+	}
+	return sortedKeys(affected)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Changelog renders the diff as an entry for docs/history.md.
+func (d DatasetDiff) Changelog() (string, error) {
+	var buf bytes.Buffer
+	if err := changelogTemplate.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func dataCentersByName(dataCenters []subnetcalc.DataCenter) map[string]subnetcalc.DataCenter {
+	byName := make(map[string]subnetcalc.DataCenter, len(dataCenters))
+	for _, dataCenter := range dataCenters {
+		byName[strings.ToLower(dataCenter.Name)] = dataCenter
+	}
+	return byName
+}
+
+func unionKeys(left map[string]subnetcalc.DataCenter, right map[string]subnetcalc.DataCenter) []string {
+	keys := []string{}
+	for key := range left {
+		keys = append(keys, key)
+	}
+	for key := range right {
+		if _, ok := left[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func metadataChanges(before subnetcalc.DataCenter, after subnetcalc.DataCenter) []MetadataChange {
+	var changes []MetadataChange
+
+	fields := []struct {
+		name     string
+		from, to string
+	}{
+		{"city", before.City, after.City},
+		{"state", before.State, after.State},
+		{"country", before.Country, after.Country},
+		{"geo_region", before.GeoRegion, after.GeoRegion},
+		{"status", before.Status, after.Status},
+		{"closure_date", before.ClosureDate, after.ClosureDate},
+	}
+
+	for _, field := range fields {
+		if field.from != field.to {
+			changes = append(changes, MetadataChange{DataCenter: strings.ToLower(after.Name), Field: field.name, From: field.from, To: field.to})
+		}
+	}
+
+	return changes
+}
+
+// cidrChanges compares the CIDR blocks of each service of a data center. A data
+// center missing from one side is compared against no CIDR blocks.
+func cidrChanges(name string, before subnetcalc.DataCenter, after subnetcalc.DataCenter) []CidrChange {
+	beforeBlocks := cidrsByService(before)
+	afterBlocks := cidrsByService(after)
+
+	var keys []serviceKey
+	for key := range beforeBlocks {
+		keys = append(keys, key)
+	}
+	for key := range afterBlocks {
+		if _, ok := beforeBlocks[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].service != keys[j].service {
+			return keys[i].service < keys[j].service
+		}
+		return keys[i].pod < keys[j].pod
+	})
+
+	var changes []CidrChange
+	for _, key := range keys {
+		added := difference(afterBlocks[key], beforeBlocks[key])
+		removed := difference(beforeBlocks[key], afterBlocks[key])
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		changes = append(changes, CidrChange{
+			DataCenter: name,
+			Service:    key.service,
+			Pod:        key.pod,
+			Added:      added,
+			Removed:    removed,
+		})
+	}
+
+	return changes
+}
+
+func cidrsByService(dataCenter subnetcalc.DataCenter) map[serviceKey]map[string]bool {
+	blocks := map[serviceKey]map[string]bool{}
+	for _, block := range dataCenter.ServiceBlocks() {
+		key := serviceKey{service: block.Service, pod: block.Key}
+		if blocks[key] == nil {
+			blocks[key] = map[string]bool{}
+		}
+		for _, cidr := range block.CidrBlocks {
+			if cidr != "" {
+				blocks[key][cidr] = true
+			}
+		}
+	}
+	return blocks
+}
+
+// flowChanges compares the required flows of each service of a data center.
+func flowChanges(name string, before subnetcalc.DataCenter, after subnetcalc.DataCenter) []FlowChange {
+	beforeFlows := flowsByService(before)
+	afterFlows := flowsByService(after)
+
+	services := map[string]bool{}
+	for service := range beforeFlows {
+		services[service] = true
+	}
+	for service := range afterFlows {
+		services[service] = true
+	}
+
+	var changes []FlowChange
+	for _, service := range sortedKeys(services) {
+		added := difference(afterFlows[service], beforeFlows[service])
+		removed := difference(beforeFlows[service], afterFlows[service])
+		if len(added) > 0 || len(removed) > 0 {
+			changes = append(changes, FlowChange{DataCenter: name, Service: service, Added: added, Removed: removed})
+		}
+	}
+	return changes
+}
+
+func flowsByService(dataCenter subnetcalc.DataCenter) map[string]map[string]bool {
+	flows := map[string]map[string]bool{}
+	for _, block := range dataCenter.ServiceBlocks() {
+		for _, flow := range block.Flows {
+			if flows[block.Service] == nil {
+				flows[block.Service] = map[string]bool{}
+			}
+			flows[block.Service][flow.String()] = true
+		}
+	}
+	return flows
+}
+
+// difference returns the sorted CIDR blocks of left that are not in right.
+func difference(left map[string]bool, right map[string]bool) []string {
+	result := []string{}
+	for cidr := range left {
+		if !right[cidr] {
+			result = append(result, cidr)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+var changelogTemplate = template.Must(template.New("changelog").Funcs(template.FuncMap{
+	"codes": func(values []string) string {
+		quoted := make([]string, 0, len(values))
+		for _, value := range values {
+			quoted = append(quoted, "`"+value+"`")
+		}
+		return strings.Join(quoted, ", ")
+	},
+}).Parse(`## {{ .To }}
+
+IBM Cloud IP ranges changes since {{ if .From }}{{ .From }}{{ else }}the previous version{{ end }}.
+{{- if .Empty }}
+
+No changes.
+{{- end }}
+{{- if or .DataCentersAdded .DataCentersRemoved }}
+{{ end }}
+{{- if .DataCentersAdded }}
+- Added data centers: {{ codes .DataCentersAdded }}
+{{- end }}
+{{- if .DataCentersRemoved }}
+- Removed data centers: {{ codes .DataCentersRemoved }}
+{{- end }}
+{{- if .CidrChanges }}
+
+### CIDR changes
+
+| Data center | Service | Added | Removed |
+|---|---|---|---|
+{{- range .CidrChanges }}
+| {{ .DataCenter }} | {{ .Service }}{{ if .Pod }} ({{ .Pod }}){{ end }} | {{ codes .Added }} | {{ codes .Removed }} |
+{{- end }}
+{{- end }}
+{{- if .MetadataChanges }}
+
+### Metadata changes
+
+| Data center | Field | From | To |
+|---|---|---|---|
+{{- range .MetadataChanges }}
+| {{ .DataCenter }} | {{ .Field }} | {{ .From }} | {{ .To }} |
+{{- end }}
+{{- end }}
+{{- if .FlowChanges }}
+
+### Required flow changes
+
+| Data center | Service | Added | Removed |
+|---|---|---|---|
+{{- range .FlowChanges }}
+| {{ .DataCenter }} | {{ .Service }} | {{ codes .Added }} | {{ codes .Removed }} |
+{{- end }}
+{{- end }}
+`))
+
+// prependChangelog inserts entry after the title of a history.md document, or
+// starts a new document when history is empty.
+func prependChangelog(history []byte, entry string) []byte {
+	content := string(history)
+	if strings.TrimSpace(content) == "" {
+		return []byte(fmt.Sprintf("# Release notes\n\n%s", entry))
+	}
+
+	if strings.HasPrefix(content, "# ") {
+		end := strings.Index(content, "\n")
+		if end == -1 {
+			return []byte(content + "\n\n" + entry)
+		}
+		return []byte(content[:end+1] + "\n" + entry + "\n" + strings.TrimLeft(content[end+1:], "\n"))
+	}
+
+	return []byte(entry + "\n" + content)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"dprosper/calculator/internal/subnetcalc"
+)
+
+// flowPattern matches a required flow such as "Outbound TCP 443",
+// "Inbound TCP/UDP 8000-8010, 9000" or "Outbound ICMP".
+var flowPattern = regexp.MustCompile(`(?i)^(inbound|outbound)\s+(tcp/udp|tcp|udp|icmp|any|all)(?:\s+(?:ports?\s+)?(.+))?$`)
+
+// parseFlows reads the required flows of a cell, one per line, with or without
+// a list marker. It returns the flows and the lines that are not a flow.
+func parseFlows(cell string) ([]subnetcalc.Flow, []string) {
+	var flows []subnetcalc.Flow
+	var invalid []string
+
+	cell = footnotePattern.ReplaceAllString(cell, "")
+	for _, line := range lineBreakPattern.Split(cell, -1) {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•"))
+		if line == "" {
+			continue
+		}
+
+		parsed, ok := parseFlow(line)
+		if !ok {
+			invalid = append(invalid, line)
+			continue
+		}
+		flows = append(flows, parsed...)
+	}
+
+	return flows, invalid
+}
+
+// parseFlow returns a flow for each protocol and port of line.
+func parseFlow(line string) ([]subnetcalc.Flow, bool) {
+	match := flowPattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+
+	direction := strings.ToLower(match[1])
+	protocols := strings.Split(strings.ToLower(match[2]), "/")
+	if protocols[0] == "all" {
+		protocols[0] = "any"
+	}
+
+	ports := []string{""}
+	if match[3] != "" {
+		if protocols[0] == "icmp" || protocols[0] == "any" {
+			return nil, false
+		}
+		ports = ports[:0]
+		for _, port := range strings.Split(match[3], ",") {
+			port = strings.Join(strings.Fields(strings.NewReplacer("–", "-").Replace(port)), "")
+			if !validPorts(port) {
+				return nil, false
+			}
+			ports = append(ports, port)
+		}
+	}
+
+	var flows []subnetcalc.Flow
+	for _, protocol := range protocols {
+		for _, port := range ports {
+			flows = append(flows, subnetcalc.Flow{Direction: direction, Protocol: protocol, Ports: port})
+		}
+	}
+	return flows, true
+}
+
+// validPorts reports whether ports is a port or a range of ports such as
+// 8000-8010.
+func validPorts(ports string) bool {
+	bounds := strings.Split(ports, "-")
+	if len(bounds) > 2 {
+		return false
+	}
+
+	previous := 0
+	for _, bound := range bounds {
+		port, err := strconv.Atoi(bound)
+		if err != nil || port < 1 || port > 65535 || port < previous {
+			return false
+		}
+		previous = port
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClosedListing is a data center marked closed in the metadata that ips.md
+// still lists, with the networks it is listed in.
+type ClosedListing struct {
+	DataCenter string   `json:"data_center"`
+	Networks   []string `json:"networks"`
+}
+
+func (l ClosedListing) String() string {
+	return fmt.Sprintf("%s is closed but still listed in %s", l.DataCenter, strings.Join(l.Networks, ", "))
+}
+
+// closedListings returns the closed data centers of metadata found in ips, in
+// name order. A Red Hat row also lists the data center of its servers.
+func closedListings(metadata Metadata, ips []IPS) []ClosedListing {
+	closed := map[string]bool{}
+	for _, name := range metadata.Closed() {
+		closed[name] = true
+	}
+
+	networks := map[string]map[string]bool{}
+	add := func(dataCenter string, network string) {
+		dataCenter = strings.ToLower(dataCenter)
+		if !closed[dataCenter] {
+			return
+		}
+		if networks[dataCenter] == nil {
+			networks[dataCenter] = map[string]bool{}
+		}
+		networks[dataCenter][network] = true
+	}
+
+	for _, line := range ips {
+		add(line.DataCenter, line.Network)
+		if line.Network == "rhe_ls" {
+			add(strings.Join(line.CidrBlocks, ""), line.Network)
+		}
+	}
+
+	listings := []ClosedListing{}
+	for _, name := range metadata.Closed() {
+		if networks[name] != nil {
+			listings = append(listings, ClosedListing{DataCenter: name, Networks: sortedKeys(networks[name])})
+		}
+	}
+	return listings
+}
@@ -0,0 +1,190 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	anchorPattern    = regexp.MustCompile(`\{:\s*#([A-Za-z0-9_-]+)\s*\}\s*$`)
+	attributePattern = regexp.MustCompile(`^\{:.*\}$`)
+	tabTitlePattern  = regexp.MustCompile(`tab-title="([^"]*)"`)
+	separatorPattern = regexp.MustCompile(`^:?-+:?$`)
+	footnotePattern  = regexp.MustCompile(`\[\^[^\]]*\]`)
+	lineBreakPattern = regexp.MustCompile(`(?i)\\n|<br\s*/?>`)
+)
+
+// Section is the part of ips.md that follows a {: #anchor} line, up to the next anchor.
+type Section struct {
+	Anchor string
+	Line   int
+	Tables []Table
+}
+
+// Table is a markdown table. Attributes such as {: tab-title="eVault"} that
+// follow the table are kept in TabTitle.
+type Table struct {
+	Headers  []string
+	Rows     []Row
+	TabTitle string
+	Line     int
+}
+
+// Row is a table row. Cells are looked up by header name with Get.
+type Row struct {
+	Cells   []string
+	Line    int
+	columns map[string]int
+}
+
+// ParseMarkdown splits a markdown document into its anchored sections and tables.
+// Content before the first anchor is returned in a section with an empty anchor.
+func ParseMarkdown(r io.Reader) ([]Section, error) {
+	sections := []Section{{}}
+	current := &sections[0]
+	var table *Table
+	inTable := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "|") {
+			cells := splitRow(line)
+			if !inTable {
+				current.Tables = append(current.Tables, Table{Headers: cells, Line: lineNumber})
+				table = &current.Tables[len(current.Tables)-1]
+				inTable = true
+				continue
+			}
+			if len(table.Rows) == 0 && isSeparator(cells) {
+				continue
+			}
+			table.Rows = append(table.Rows, Row{Cells: cells, Line: lineNumber})
+			continue
+		}
+		inTable = false
+
+		if match := anchorPattern.FindStringSubmatch(line); match != nil {
+			sections = append(sections, Section{Anchor: match[1], Line: lineNumber})
+			current = &sections[len(sections)-1]
+			table = nil
+			continue
+		}
+
+		if table != nil && attributePattern.MatchString(line) {
+			if match := tabTitlePattern.FindStringSubmatch(line); match != nil {
+				table.TabTitle = match[1]
+			}
+			continue
+		}
+
+		if line != "" {
+			table = nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sections, nil
+}
+
+// Columns maps each of the requested names to the index of its header. A name
+// matches a header that is equal to it or contains it, ignoring case and
+// emphasis, e.g. "ip range" matches "IP ranges". Names without a header are
+// returned as missing.
+func (t Table) Columns(names []string) (map[string]int, []string) {
+	headers := make([]string, len(t.Headers))
+	for i, header := range t.Headers {
+		headers[i] = normalizeHeader(header)
+	}
+
+	columns := map[string]int{}
+	var missing []string
+
+	for _, name := range names {
+		index := -1
+		for i, header := range headers {
+			if header == name {
+				index = i
+				break
+			}
+			if index == -1 && strings.Contains(header, name) {
+				index = i
+			}
+		}
+
+		if index == -1 {
+			missing = append(missing, name)
+			continue
+		}
+		columns[name] = index
+	}
+
+	return columns, missing
+}
+
+// Get returns the trimmed cell under the named column, or an empty string.
+func (r Row) Get(name string) string {
+	index, ok := r.columns[name]
+	if !ok || index >= len(r.Cells) {
+		return ""
+	}
+	return r.Cells[index]
+}
+
+// cidrList flattens the CIDR blocks of a cell, which are separated by \n or
+// <br> and may carry footnote references, into a space separated list. Blocks
+// are kept as written, a repeated block is reported by ValidateIPRanges.
+func cidrList(cell string) string {
+	cell = footnotePattern.ReplaceAllString(cell, "")
+	cell = lineBreakPattern.ReplaceAllString(cell, " ")
+	return strings.Join(strings.Fields(cell), " ")
+}
+
+func splitRow(line string) []string {
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+	}
+	return cells
+}
+
+func isSeparator(cells []string) bool {
+	for _, cell := range cells {
+		if !separatorPattern.MatchString(cell) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeHeader(header string) string {
+	header = strings.NewReplacer("*", "", "_", " ").Replace(header)
+	return strings.Join(strings.Fields(strings.ToLower(header)), " ")
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"dprosper/calculator/internal/subnetcalc"
+)
+
+// Paths of the data center metadata and of the stub written for the data
+// centers it misses, relative to the backend-job directory.
+const (
+	MetadataPath     = "ibm-cloud-data-centers.json"
+	MetadataStubPath = "ibm-cloud-data-centers.stub.json"
+)
+
+// Location is the metadata of a data center. Status is one of the
+// subnetcalc lifecycle statuses, active when empty, and ClosureDate the
+// announced closure.
+type Location struct {
+	City        string `json:"city"`
+	State       string `json:"state"`
+	Country     string `json:"country"`
+	GeoRegion   string `json:"geo_region"`
+	Status      string `json:"status,omitempty"`
+	ClosureDate string `json:"closure_date,omitempty"`
+}
+
+// Metadata maps data center names to their location, as in MetadataPath.
+type Metadata map[string]Location
+
+// ParseMetadata reads the metadata file. Unknown fields are rejected so a typo
+// does not silently leave a field empty, and so are unknown statuses and
+// closure dates that do not parse.
+func ParseMetadata(data []byte) (Metadata, error) {
+	var metadata Metadata
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("error parsing data center metadata: %w", err)
+	}
+
+	for _, name := range sortedNames(metadata) {
+		location := metadata[name]
+		if err := subnetcalc.CheckLifecycle(location.Status, location.ClosureDate); err != nil {
+			return nil, fmt.Errorf("error in data center metadata of %s: %w", name, err)
+		}
+	}
+	return metadata, nil
+}
+
+// Closed returns the sorted names of the closed data centers.
+func (m Metadata) Closed() []string {
+	closed := []string{}
+	for _, name := range sortedNames(m) {
+		if m[name].Status == subnetcalc.StatusClosed {
+			closed = append(closed, name)
+		}
+	}
+	return closed
+}
+
+// Missing returns the sorted names that have no entry, or an entry without a
+// city or geo region.
+func (m Metadata) Missing(names []string) []string {
+	missing := map[string]bool{}
+	for _, name := range names {
+		location, ok := m[strings.ToLower(name)]
+		if !ok || location.City == "" || location.GeoRegion == "" {
+			missing[strings.ToLower(name)] = true
+		}
+	}
+	return sortedKeys(missing)
+}
+
+// MetadataStub returns entries for names to review and merge into
+// MetadataPath. Fields already known are kept.
+func (m Metadata) MetadataStub(names []string) ([]byte, error) {
+	stub := Metadata{}
+	for _, name := range names {
+		stub[name] = m[name]
+	}
+
+	data, err := json.MarshalIndent(stub, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func sortedNames(m Metadata) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dataCenterNames returns the names of the data centers in ipRanges.
+func dataCenterNames(ipRanges ICIPRanges) []string {
+	names := make([]string, 0, len(ipRanges.DataCenters))
+	for _, dataCenter := range ipRanges.DataCenters {
+		names = append(names, dataCenter.Name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"dprosper/calculator/internal/logger"
+	"dprosper/calculator/internal/watch"
+
+	"go.uber.org/zap"
+)
+
+// EventPublished is the event of a newly published version of the data set.
+const EventPublished = "dataset.published"
+
+// ReleaseEvent tells notifiers about a published version and the conflicts
+// with watched CIDRs it introduced.
+type ReleaseEvent struct {
+	Event        string           `json:"event"`
+	Version      string           `json:"version"`
+	LastUpdated  string           `json:"last_updated"`
+	Diff         DatasetDiff      `json:"diff"`
+	NewConflicts []watch.Conflict `json:"new_conflicts"`
+}
+
+// Notifier is told about each published version, such as webhook subscribers.
+type Notifier interface {
+	Notify(event ReleaseEvent) error
+}
+
+// notify sends event to every notifier. The version is already published, so a
+// failed notification is logged and does not fail the update.
+func notify(notifiers []Notifier, event ReleaseEvent) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(event); err != nil {
+			logger.ErrorLogger.Error("error notifying about the published version",
+				zap.String("version", event.Version),
+				zap.String("error: ", err.Error()),
+			)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"dprosper/calculator/internal/subnetcalc"
+)
+
+// BuildResult is the output of BuildIPRanges.
+type BuildResult struct {
+	IPRanges ICIPRanges
+	Tags     []TagPicker
+	// IPS are the records read from ips.md in document order.
+	IPS    []IPS
+	Report ParseReport
+	// MissingMetadata are the data centers of ips.md without a city or geo
+	// region in the metadata, MetadataStub has an entry for each to fill in.
+	MissingMetadata []string
+	MetadataStub    []byte
+	// ClosedListed are the data centers closed in the metadata that ips.md
+	// still lists.
+	ClosedListed []ClosedListing
+	// RuleFailures are the dependency rules that cannot be applied to ips.md
+	// or that map a Red Hat server location differently.
+	RuleFailures []ValidationIssue
+}
+
+// BuildIPRanges turns the ips.md markdown, the data center metadata of
+// ibm-cloud-data-centers.json and the service dependency rules of
+// service-dependencies.json into the data set. It does no I/O, lastUpdated is
+// the date recorded in the data set. The parse report is returned with the
+// error when ips.md does not have the expected layout.
+func BuildIPRanges(markdown []byte, metadata []byte, rules []byte, lastUpdated time.Time) (BuildResult, error) {
+	sections, err := ParseMarkdown(bytes.NewReader(markdown))
+	if err != nil {
+		return BuildResult{}, fmt.Errorf("error reading ips.md: %w", err)
+	}
+
+	tables, report := checkSections(sections)
+	result := BuildResult{Report: report}
+	if err := report.Err(); err != nil {
+		return result, err
+	}
+
+	metadataParsed, err := ParseMetadata(metadata)
+	if err != nil {
+		return result, err
+	}
+
+	rulesParsed, err := ParseDependencyRules(rules)
+	if err != nil {
+		return result, err
+	}
+
+	for _, table := range tables {
+		for _, row := range table.rows {
+			if row.Get("data center") == "" {
+				continue
+			}
+			for _, ips := range table.spec.parse(row, table.service) {
+				ips.Flows = table.flows
+				result.IPS = append(result.IPS, ips)
+			}
+		}
+	}
+
+	sorted := append([]IPS{}, result.IPS...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].DataCenter < sorted[j].DataCenter
+	})
+
+	result.IPRanges, result.Tags = createDataCentersJSON(sorted, metadataParsed, rulesParsed, lastUpdated)
+	result.RuleFailures = checkDependencyRules(rulesParsed, result.IPS, metadataParsed)
+	result.ClosedListed = closedListings(metadataParsed, result.IPS)
+	result.MissingMetadata = metadataParsed.Missing(dataCenterNames(result.IPRanges))
+	if len(result.MissingMetadata) > 0 {
+		result.MetadataStub, err = metadataParsed.MetadataStub(result.MissingMetadata)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// LoadIPRanges reads a data set written by the updater, such as data/datacenters.json.
+func LoadIPRanges(path string) (ICIPRanges, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ICIPRanges{}, err
+	}
+
+	ipRanges, err := LoadIPRangesData(data)
+	if err != nil {
+		return ipRanges, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return ipRanges, nil
+}
+
+// LoadIPRangesData parses a data set written by the updater. Older data sets are
+// migrated to subnetcalc.SchemaVersion, incompatible ones are rejected.
+func LoadIPRangesData(data []byte) (ICIPRanges, error) {
+	var ipRanges ICIPRanges
+	err := subnetcalc.DecodeDataset(data, &ipRanges)
+	return ipRanges, err
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"dprosper/calculator/internal/watch"
+)
+
+// Plan is what an update would publish: the new data set compared with the
+// published one and validated.
+type Plan struct {
+	Source     string           `json:"source"`
+	Warnings   []ParseIssue     `json:"warnings"`
+	Diff       DatasetDiff      `json:"diff"`
+	Validation ValidationReport `json:"validation"`
+	// NewConflicts are the watched CIDRs that overlap ranges the new data set
+	// adds.
+	NewConflicts []watch.Conflict `json:"new_conflicts"`
+	// MissingMetadata are the data centers without a city or geo region in
+	// MetadataPath, MetadataStub has an entry to fill in for each.
+	MissingMetadata []string `json:"missing_metadata"`
+	MetadataStub    []byte   `json:"-"`
+	// ClosedListed are the closed data centers that ips.md still lists.
+	ClosedListed []ClosedListing `json:"closed_listed"`
+
+	ipRanges ICIPRanges
+	previous ICIPRanges
+}
+
+// Changed reports whether publishing the plan changes the data set.
+func (p Plan) Changed() bool {
+	return !p.Diff.Empty() || len(p.previous.DataCenters) == 0
+}
+
+// buildPlan builds the data set from markdown and compares it with the data set
+// in DatasetPath and with the watched CIDRs. It only reads files.
+func buildPlan(markdown []byte, metadata []byte, rules []byte, options UpdateOptions, lastRan time.Time) (Plan, error) {
+	plan := Plan{Source: options.Source.String()}
+
+	result, err := BuildIPRanges(markdown, metadata, rules, lastRan)
+	plan.Warnings = result.Report.Warnings
+	if err != nil {
+		return plan, fmt.Errorf("the data set could not be built: %w", err)
+	}
+	plan.ipRanges = result.IPRanges
+	plan.MissingMetadata = result.MissingMetadata
+	plan.MetadataStub = result.MetadataStub
+	plan.ClosedListed = result.ClosedListed
+
+	plan.previous, err = LoadIPRanges(DatasetPath)
+	if err != nil && !os.IsNotExist(err) {
+		return plan, fmt.Errorf("error reading the previous data set: %w", err)
+	}
+
+	plan.Diff = DiffIPRanges(plan.previous, plan.ipRanges)
+	validation := DefaultValidationOptions
+	validation.AllowMissingMetadata = options.AllowMissingMetadata
+	validation.NoPrivateNetworks = options.NoPrivateNetworks
+	plan.Validation = ValidateIPRanges(plan.ipRanges, plan.previous, validation)
+	plan.Validation.Failures = append(plan.Validation.Failures, result.RuleFailures...)
+
+	plan.NewConflicts = watch.NewConflicts(
+		watch.FindConflicts(options.Watched, plan.previous.DataCenters),
+		watch.FindConflicts(options.Watched, plan.ipRanges.DataCenters),
+	)
+
+	return plan, nil
+}
+
+// PlanUpdate fetches ips.md from options.Source, builds, diffs and validates the
+// data set like UpdateIPRanges, but writes nothing: the state file, ../data,
+// the archive, the snapshot and the metadata stub are left as they are. ips.md
+// is always fetched.
+func PlanUpdate(options UpdateOptions) (Plan, error) {
+	metadata, err := os.ReadFile(MetadataPath)
+	if err != nil {
+		return Plan{Source: options.Source.String()}, fmt.Errorf("error in opening file %s: %w", MetadataPath, err)
+	}
+
+	rules, err := os.ReadFile(RulesPath)
+	if err != nil {
+		return Plan{Source: options.Source.String()}, fmt.Errorf("error in opening file %s: %w", RulesPath, err)
+	}
+
+	markdown, err := options.Source.Fetch()
+	if err != nil {
+		return Plan{Source: options.Source.String()}, fmt.Errorf("error getting ips.md from %s: %w", options.Source, err)
+	}
+
+	return buildPlan(markdown, metadata, rules, options, time.Now())
+}
+
+// WriteSummary writes a review of the plan: the affected data centers and
+// services, the changelog entry that would be published and the validation
+// result.
+func (p Plan) WriteSummary(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Source: %s\n", p.Source)
+	if len(p.previous.DataCenters) > 0 {
+		fmt.Fprintf(&b, "Published data set: %s, %d data centers\n", p.previous.LastUpdated, len(p.previous.DataCenters))
+	} else {
+		fmt.Fprintf(&b, "Published data set: none\n")
+	}
+	fmt.Fprintf(&b, "New data set: %s, %d data centers\n", p.ipRanges.LastUpdated, len(p.ipRanges.DataCenters))
+
+	if len(p.Warnings) > 0 {
+		fmt.Fprintf(&b, "\nips.md warnings:\n")
+		for _, warning := range p.Warnings {
+			fmt.Fprintf(&b, "  - %s\n", warning)
+		}
+	}
+
+	if !p.Changed() {
+		fmt.Fprintf(&b, "\nNo changes, nothing would be published.\n")
+	} else {
+		fmt.Fprintf(&b, "\nAffected data centers: %s\n", listOrNone(p.Diff.AffectedDataCenters()))
+		fmt.Fprintf(&b, "Affected services: %s\n\n", listOrNone(p.Diff.AffectedServices()))
+
+		changelog, err := p.Diff.Changelog()
+		if err != nil {
+			return err
+		}
+		b.WriteString(changelog)
+	}
+
+	if len(p.MissingMetadata) > 0 {
+		fmt.Fprintf(&b, "\nData centers missing from %s: %s\n", MetadataPath, strings.Join(p.MissingMetadata, ", "))
+		fmt.Fprintf(&b, "Metadata stub to fill in:\n%s", p.MetadataStub)
+	}
+
+	if len(p.ClosedListed) > 0 {
+		fmt.Fprintf(&b, "\nClosed data centers still listed in ips.md:\n")
+		for _, listing := range p.ClosedListed {
+			fmt.Fprintf(&b, "  - %s\n", listing)
+		}
+	}
+
+	if len(p.NewConflicts) > 0 {
+		// FindConflicts sorts by owner.
+		fmt.Fprintf(&b, "\nNew conflicts with watched CIDRs:\n")
+		for _, conflict := range p.NewConflicts {
+			fmt.Fprintf(&b, "  - %s\n", conflict)
+		}
+	}
+
+	if len(p.Validation.Failures) == 0 {
+		fmt.Fprintf(&b, "\nValidation: passed\n")
+	} else {
+		fmt.Fprintf(&b, "\nValidation: failed, the data set would not be published\n")
+		for _, failure := range p.Validation.Failures {
+			fmt.Fprintf(&b, "  - %s\n", failure)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func listOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"dprosper/calculator/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// ObjectStore receives the published files, see objectstore.Client.
+type ObjectStore interface {
+	PutObject(key string, data []byte, contentType string, metadata map[string]string) error
+}
+
+// release holds the rendered files of a data set version.
+type release struct {
+	stamp     string
+	ipRanges  ICIPRanges
+	dataset   []byte
+	diff      []byte
+	changelog []byte
+}
+
+func newRelease(stamp string, ipRanges ICIPRanges, diff DatasetDiff) (release, error) {
+	changelog, err := diff.Changelog()
+	if err != nil {
+		return release{}, fmt.Errorf("error creating the changelog: %w", err)
+	}
+
+	dataset, err := json.MarshalIndent(ipRanges, "", "  ")
+	if err != nil {
+		return release{}, err
+	}
+
+	diffData, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return release{}, err
+	}
+
+	return release{stamp: stamp, ipRanges: ipRanges, dataset: dataset, diff: diffData, changelog: []byte(changelog)}, nil
+}
+
+// publishRelease uploads the versioned data set, diff and changelog under
+// versions/<stamp>/, then replaces datacenters.json at the root of the bucket so
+// readers never see a latest version without its files.
+func publishRelease(store ObjectStore, r release) error {
+	metadata := map[string]string{
+		"version":      r.ipRanges.Version,
+		"last-updated": r.ipRanges.LastUpdated,
+	}
+
+	objects := []struct {
+		key         string
+		data        []byte
+		contentType string
+	}{
+		{fmt.Sprintf("versions/%s/datacenters.json", r.stamp), r.dataset, "application/json"},
+		{fmt.Sprintf("versions/%s/changes.json", r.stamp), r.diff, "application/json"},
+		{fmt.Sprintf("versions/%s/changes.md", r.stamp), r.changelog, "text/markdown; charset=utf-8"},
+		{"datacenters.json", r.dataset, "application/json"},
+	}
+
+	for _, object := range objects {
+		if err := store.PutObject(object.key, object.data, object.contentType, metadata); err != nil {
+			return err
+		}
+		logger.SystemLogger.Info("published to object storage", zap.String("key", object.key))
+	}
+
+	return nil
+}
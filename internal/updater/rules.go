@@ -0,0 +1,219 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RulesPath is the file of the service dependency rules, relative to the
+// backend-job directory.
+const RulesPath = "service-dependencies.json"
+
+// Services whose CIDR blocks are the service networks of other data centers,
+// as named in the data set.
+const (
+	RuleServiceIMS  = "ims"
+	RuleServiceRHEL = "rhe_ls"
+)
+
+var dataCenterName = regexp.MustCompile(`^[a-z]{3}[0-9]{2}$`)
+
+// DependencyRule reads "service in these data centers requires the service
+// networks of the Requires data centers". A rule without data centers and geo
+// regions matches every data center. A Fallback rule only applies to the data
+// centers that no other rule of its service matches.
+type DependencyRule struct {
+	Service     string   `json:"service"`
+	DataCenters []string `json:"data_centers,omitempty"`
+	GeoRegions  []string `json:"geo_regions,omitempty"`
+	Requires    []string `json:"requires"`
+	Fallback    bool     `json:"fallback,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+func (r DependencyRule) matches(dataCenter string, geoRegion string) bool {
+	if len(r.DataCenters) == 0 && len(r.GeoRegions) == 0 {
+		return true
+	}
+	return contains(r.DataCenters, dataCenter) || (len(r.GeoRegions) > 0 && matches(r.GeoRegions, geoRegion))
+}
+
+// DependencyRules are the rules of RulesPath.
+type DependencyRules struct {
+	Rules []DependencyRule `json:"rules"`
+}
+
+// ParseDependencyRules reads and validates the rules file. Unknown fields are
+// rejected.
+func ParseDependencyRules(data []byte) (DependencyRules, error) {
+	var rules DependencyRules
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return rules, fmt.Errorf("error parsing service dependency rules: %w", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
+
+// Validate checks the service and the data center names of each rule, and that
+// a service has at most one fallback rule.
+func (r DependencyRules) Validate() error {
+	var problems []string
+	fallbacks := map[string]bool{}
+
+	for i, rule := range r.Rules {
+		prefix := fmt.Sprintf("rule %d (%s)", i+1, rule.Service)
+
+		if rule.Service != RuleServiceIMS && rule.Service != RuleServiceRHEL {
+			problems = append(problems, fmt.Sprintf("%s: unknown service, expected %s or %s", prefix, RuleServiceIMS, RuleServiceRHEL))
+		}
+		if len(rule.Requires) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: requires no data center", prefix))
+		}
+		if rule.Fallback {
+			if len(rule.DataCenters) > 0 || len(rule.GeoRegions) > 0 {
+				problems = append(problems, fmt.Sprintf("%s: a fallback rule cannot list data centers or geo regions", prefix))
+			}
+			if fallbacks[rule.Service] {
+				problems = append(problems, fmt.Sprintf("%s: the service has more than one fallback rule", prefix))
+			}
+			fallbacks[rule.Service] = true
+		}
+
+		for _, field := range []struct {
+			name  string
+			names []string
+		}{
+			{"data_centers", rule.DataCenters},
+			{"requires", rule.Requires},
+		} {
+			seen := map[string]bool{}
+			for _, name := range field.names {
+				if !dataCenterName.MatchString(name) {
+					problems = append(problems, fmt.Sprintf("%s: %s has an invalid data center name %q", prefix, field.name, name))
+				}
+				if seen[name] {
+					problems = append(problems, fmt.Sprintf("%s: %s lists %s more than once", prefix, field.name, name))
+				}
+				seen[name] = true
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid service dependency rules in %s: %s", RulesPath, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Requires returns the data centers whose service networks service needs in
+// dataCenter, in rule order.
+func (r DependencyRules) Requires(service string, dataCenter string, geoRegion string) []string {
+	required := []string{}
+	add := func(rule DependencyRule) {
+		for _, name := range rule.Requires {
+			if !contains(required, name) {
+				required = append(required, name)
+			}
+		}
+	}
+
+	matched := false
+	for _, rule := range r.Rules {
+		if rule.Service == service && !rule.Fallback && rule.matches(dataCenter, geoRegion) {
+			add(rule)
+			matched = true
+		}
+	}
+	if !matched {
+		for _, rule := range r.Rules {
+			if rule.Service == service && rule.Fallback {
+				add(rule)
+			}
+		}
+	}
+	return required
+}
+
+// Dependency is the service network of the data center a rule requires.
+type Dependency struct {
+	DataCenter string
+	CidrBlocks []string
+}
+
+// dependencies returns the service networks of ips that service needs in
+// dataCenter.
+func dependencies(ips []IPS, rules DependencyRules, service string, dataCenter string, geoRegion string) []Dependency {
+	var result []Dependency
+	for _, required := range rules.Requires(service, dataCenter, geoRegion) {
+		result = append(result, Dependency{DataCenter: required, CidrBlocks: getServiceNetwork(ips, required)})
+	}
+	return result
+}
+
+// checkDependencyRules compares the rules with ips.md. A required data center
+// without a service network and a Red Hat server location that maps to other
+// data centers than the Red Hat table of ips.md are failures, the rules are
+// then out of date.
+func checkDependencyRules(rules DependencyRules, ips []IPS, metadata Metadata) []ValidationIssue {
+	report := ValidationReport{}
+	checked := map[string]bool{}
+	for _, rule := range rules.Rules {
+		for _, required := range rule.Requires {
+			if checked[rule.Service+" "+required] {
+				continue
+			}
+			checked[rule.Service+" "+required] = true
+			if len(getServiceNetwork(ips, required)) == 0 {
+				report.fail(CheckDependencyRule, required, rule.Service, "required by a rule in %s but has no service network in ips.md", RulesPath)
+			}
+		}
+	}
+
+	for _, line := range ips {
+		if line.Network != RuleServiceRHEL {
+			continue
+		}
+		server := strings.Join(line.CidrBlocks, "")
+
+		var required []string
+		if line.DataCenter == "any-left" {
+			for _, rule := range rules.Rules {
+				if rule.Service == RuleServiceRHEL && rule.Fallback {
+					required = rule.Requires
+				}
+			}
+		} else {
+			required = rules.Requires(RuleServiceRHEL, line.DataCenter, metadata[line.DataCenter].GeoRegion)
+		}
+
+		if len(required) != 1 || required[0] != server {
+			report.fail(CheckDependencyRule, line.DataCenter, RuleServiceRHEL, "ips.md uses the %s servers, %s requires %s", server, RulesPath, listOrNone(required))
+		}
+	}
+
+	return report.Failures
+}
@@ -0,0 +1,254 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"fmt"
+	"strings"
+
+	"dprosper/calculator/internal/subnetcalc"
+)
+
+// sectionSpec describes a section of ips.md that is ingested: the columns its
+// tables must have and the parser that turns every row into ips records.
+type sectionSpec struct {
+	anchor  string
+	columns []string
+	// tabs maps the tab titles of a tabbed section to the service they hold.
+	tabs map[string]string
+	// flows is set when the required flows of the tables are kept with the
+	// records.
+	flows bool
+	parse func(row Row, service string) []IPS
+}
+
+var sectionSpecs = []sectionSpec{
+	{
+		anchor:  "front-end-network",
+		columns: []string{"data center", "city", "ip range"},
+		parse:   func(row Row, _ string) []IPS { return parseFEN(row) },
+	},
+	{
+		anchor:  "load-balancer-ips",
+		columns: []string{"data center", "city", "ip range"},
+		parse:   func(row Row, _ string) []IPS { return parseLBIPS(row) },
+	},
+	{
+		anchor:  "customer-private-network-space",
+		columns: []string{"city", "data center", "pod", "ip range"},
+		parse:   func(row Row, _ string) []IPS { return parseCPNS(row) },
+	},
+	{
+		anchor:  "service-network",
+		columns: []string{"data center", "city", "ip range"},
+		parse:   func(row Row, _ string) []IPS { return parseSN(row) },
+	},
+	{
+		anchor:  "service-by-data-center",
+		columns: []string{"data center", "ip range"},
+		tabs: map[string]string{
+			"eVault":           "evault",
+			"File & Block":     "file_block",
+			"AdvMon (Nimsoft)": "advmon",
+			"ICOS":             "icos",
+		},
+		flows: true,
+		parse: parseSDC,
+	},
+	{
+		anchor:  "ssl-vpn-data-centers",
+		columns: []string{"data center", "city", "ip range"},
+		parse:   func(row Row, _ string) []IPS { return parseSSLVPN(row) },
+	},
+	{
+		anchor:  "ssl-vpn-pops",
+		columns: []string{"data center", "city", "ip range"},
+		parse:   func(row Row, _ string) []IPS { return parseSSLVPNPOPS(row) },
+	},
+	{
+		anchor:  "red-hat-enterprise-linux-server",
+		columns: []string{"location", "data center"},
+		parse:   func(row Row, _ string) []IPS { return parseRHELS(row) },
+	},
+	{
+		anchor:  "legacy-networks",
+		columns: []string{"data center", "ip range"},
+		parse:   func(row Row, _ string) []IPS { return parseLegacyNetworks(row) },
+	},
+	{
+		anchor:  "windows-vsi-server",
+		columns: []string{"data center", "ip range"},
+		parse:   func(row Row, _ string) []IPS { return parseWindowsVSI(row) },
+	},
+}
+
+// ParseIssue is a problem found while matching ips.md against the expected sections.
+type ParseIssue struct {
+	Section string `json:"section"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i ParseIssue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("#%s (line %d): %s", i.Section, i.Line, i.Message)
+	}
+	return fmt.Sprintf("#%s: %s", i.Section, i.Message)
+}
+
+// ParseReport collects the issues found in ips.md. Warnings are logged, failures
+// stop the update since the data set would be incomplete or corrupted.
+type ParseReport struct {
+	Warnings []ParseIssue `json:"warnings"`
+	Failures []ParseIssue `json:"failures"`
+}
+
+func (r *ParseReport) warn(section string, line int, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, ParseIssue{Section: section, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ParseReport) fail(section string, line int, format string, args ...interface{}) {
+	r.Failures = append(r.Failures, ParseIssue{Section: section, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns an error listing the failures, or nil when there are none.
+func (r ParseReport) Err() error {
+	if len(r.Failures) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(r.Failures))
+	for _, failure := range r.Failures {
+		messages = append(messages, failure.String())
+	}
+	return fmt.Errorf("ips.md does not match the expected layout: %s", strings.Join(messages, "; "))
+}
+
+// sectionTable is a table that passed validation, with the parser for its rows.
+type sectionTable struct {
+	spec    sectionSpec
+	service string
+	rows    []Row
+	// flows are the required flows listed with the table.
+	flows []subnetcalc.Flow
+}
+
+// checkSections validates the parsed sections against sectionSpecs and returns
+// the tables to ingest. Missing sections and tables without the expected
+// columns are failures, unknown sections holding tables are warnings.
+func checkSections(sections []Section) ([]sectionTable, ParseReport) {
+	var report ParseReport
+	var tables []sectionTable
+	found := map[string]bool{}
+
+	specs := map[string]sectionSpec{}
+	for _, spec := range sectionSpecs {
+		specs[spec.anchor] = spec
+	}
+
+	for _, section := range sections {
+		spec, ok := specs[section.Anchor]
+		if !ok {
+			if len(section.Tables) > 0 {
+				report.warn(section.Anchor, section.Line, "section has %d table(s) that are not ingested", len(section.Tables))
+			}
+			continue
+		}
+		found[section.Anchor] = true
+
+		for _, table := range section.Tables {
+			if isRequiredFlows(table.Headers) {
+				// A table of required flows belongs to the table before it.
+				last := len(tables) - 1
+				if !spec.flows || last < 0 || tables[last].spec.anchor != spec.anchor {
+					report.warn(section.Anchor, table.Line, "required flows are not ingested")
+					continue
+				}
+				cells := append([]string{}, table.Headers[1:]...)
+				for _, row := range table.Rows {
+					cells = append(cells, row.Cells...)
+				}
+				tables[last].flows = append(tables[last].flows, requiredFlows(&report, section.Anchor, table.Line, cells)...)
+				continue
+			}
+
+			service := ""
+			if spec.tabs != nil {
+				service, ok = spec.tabs[table.TabTitle]
+				if !ok {
+					report.warn(section.Anchor, table.Line, "table with tab title %q is not ingested", table.TabTitle)
+					continue
+				}
+			}
+
+			columns, missing := table.Columns(spec.columns)
+			if len(missing) > 0 {
+				report.fail(section.Anchor, table.Line, "table is missing column(s) %s, found %s", strings.Join(missing, ", "), strings.Join(table.Headers, ", "))
+				continue
+			}
+
+			rows := make([]Row, 0, len(table.Rows))
+			var flows []subnetcalc.Flow
+			for _, row := range table.Rows {
+				if isRequiredFlows(row.Cells) {
+					if spec.flows {
+						flows = append(flows, requiredFlows(&report, section.Anchor, row.Line, row.Cells[1:])...)
+					} else {
+						report.warn(section.Anchor, row.Line, "required flows are not ingested")
+					}
+					continue
+				}
+				if len(row.Cells) < len(table.Headers) {
+					report.warn(section.Anchor, row.Line, "row has %d of %d cells and is skipped", len(row.Cells), len(table.Headers))
+					continue
+				}
+				row.columns = columns
+				rows = append(rows, row)
+			}
+
+			tables = append(tables, sectionTable{spec: spec, service: service, rows: rows, flows: flows})
+		}
+	}
+
+	for _, spec := range sectionSpecs {
+		if !found[spec.anchor] {
+			report.fail(spec.anchor, 0, "section not found")
+		}
+	}
+
+	return tables, report
+}
+
+// requiredFlows parses the flows in cells. Lines that are not a flow are
+// warnings.
+func requiredFlows(report *ParseReport, section string, line int, cells []string) []subnetcalc.Flow {
+	var flows []subnetcalc.Flow
+	for _, cell := range cells {
+		parsed, invalid := parseFlows(cell)
+		flows = append(flows, parsed...)
+		for _, text := range invalid {
+			report.warn(section, line, "required flow %q is not understood and is skipped", text)
+		}
+	}
+	return flows
+}
+
+// isRequiredFlows reports whether the header or row cells start a list of the
+// required flows of a service rather than its IP ranges.
+func isRequiredFlows(cells []string) bool {
+	return len(cells) > 0 && strings.Contains(normalizeHeader(cells[0]), "required flows")
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"dprosper/calculator/internal/util"
+)
+
+// SnapshotRevisionPath records where the vendored snapshot was taken from,
+// relative to the backend-job directory.
+const SnapshotRevisionPath = "snapshot/ips.md.json"
+
+// Snapshot is what SnapshotRevisionPath holds.
+type Snapshot struct {
+	// Source is the ips.md source the snapshot was fetched from.
+	Source string `json:"source"`
+	// Revision is the docs commit of a git source, empty for other sources.
+	Revision string `json:"revision,omitempty"`
+	SHA256   string `json:"sha256"`
+}
+
+// LoadSnapshot checks the vendored snapshot exists and matches its recorded
+// revision, before an offline run.
+func LoadSnapshot() (Snapshot, error) {
+	var snapshot Snapshot
+
+	markdown, err := os.ReadFile(SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, fmt.Errorf("no vendored snapshot at %s, take one with -source git:<checkout>:ips.md@<revision> -save-snapshot", SnapshotPath)
+	}
+	if err != nil {
+		return snapshot, err
+	}
+
+	data, err := os.ReadFile(SnapshotRevisionPath)
+	if err != nil {
+		return snapshot, fmt.Errorf("the vendored snapshot has no revision record: %w", err)
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("error parsing %s: %w", SnapshotRevisionPath, err)
+	}
+
+	if sum := util.SHA256(markdown); sum != snapshot.SHA256 {
+		return snapshot, fmt.Errorf("%s has SHA-256 %s, %s records %s", SnapshotPath, sum, SnapshotRevisionPath, snapshot.SHA256)
+	}
+	return snapshot, nil
+}
+
+// saveSnapshot replaces the vendored snapshot with markdown and records the
+// revision it was fetched at.
+func saveSnapshot(source Source, markdown []byte) error {
+	snapshot := Snapshot{Source: source.String(), SHA256: util.SHA256(markdown)}
+	if git, ok := source.(GitSource); ok {
+		revision, err := git.ResolveRevision()
+		if err != nil {
+			return err
+		}
+		snapshot.Revision = revision
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(SnapshotPath), 0755); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(SnapshotPath, markdown, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", SnapshotPath, err)
+	}
+	if err := util.WriteFileAtomic(SnapshotRevisionPath, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", SnapshotRevisionPath, err)
+	}
+	return nil
+}
+
+// ResolveRevision returns the commit ips.md is read at, HEAD for the working
+// tree.
+func (s GitSource) ResolveRevision() (string, error) {
+	revision := s.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+
+	cmd := exec.Command("git", "-C", s.Checkout, "rev-parse", "--verify", revision+"^{commit}")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error resolving revision %s of %s: %w: %s", revision, s.Checkout, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"dprosper/calculator/internal/logger"
+	"dprosper/calculator/internal/util"
+)
+
+// DefaultSourceURL is the published ips.md of the IBM Cloud docs.
+const DefaultSourceURL = "https://raw.githubusercontent.com/ibm-cloud-docs/cloud-infrastructure/master/ips.md"
+
+// SnapshotPath is the vendored copy of ips.md used in offline mode, relative to
+// the backend-job directory.
+const SnapshotPath = "snapshot/ips.md"
+
+// Source provides the ips.md markdown.
+type Source interface {
+	Fetch() ([]byte, error)
+	String() string
+}
+
+// ConditionalSource is a Source that can skip the download when the content did
+// not change since a previous fetch.
+type ConditionalSource interface {
+	Source
+	FetchIfChanged(previous util.FetchState) (util.FetchResult, error)
+}
+
+// fetchSource fetches ips.md, conditionally when the source supports it. The
+// result is Unchanged when the content has the hash recorded in previous.
+func fetchSource(source Source, previous util.FetchState) (util.FetchResult, error) {
+	if conditional, ok := source.(ConditionalSource); ok {
+		return conditional.FetchIfChanged(previous)
+	}
+
+	body, err := source.Fetch()
+	if err != nil {
+		return util.FetchResult{}, err
+	}
+
+	state := util.FetchState{SHA256: util.SHA256(body)}
+	return util.FetchResult{Body: body, State: state, Unchanged: previous.SHA256 != "" && state.SHA256 == previous.SHA256}, nil
+}
+
+// ParseSource returns the source described by spec:
+//   - http:// or https:// URL
+//   - git:<checkout>[:<path>][@<revision>], ips.md in a local git checkout, at
+//     the working tree or at a revision
+//   - file:<path> or a plain path
+func ParseSource(spec string) (Source, error) {
+	switch {
+	case spec == "":
+		return nil, fmt.Errorf("no source given")
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		if _, err := url.ParseRequestURI(spec); err != nil {
+			return nil, fmt.Errorf("invalid source URL %q: %w", spec, err)
+		}
+		return HTTPSource{URL: spec}, nil
+	case strings.HasPrefix(spec, "git:"):
+		return parseGitSource(strings.TrimPrefix(spec, "git:"))
+	default:
+		return FileSource{Path: strings.TrimPrefix(spec, "file:")}, nil
+	}
+}
+
+func parseGitSource(spec string) (Source, error) {
+	source := GitSource{Path: "ips.md"}
+
+	if i := strings.LastIndex(spec, "@"); i != -1 {
+		source.Revision = spec[i+1:]
+		spec = spec[:i]
+	}
+	if i := strings.Index(spec, ":"); i != -1 {
+		source.Path = spec[i+1:]
+		spec = spec[:i]
+	}
+	source.Checkout = spec
+
+	if source.Checkout == "" {
+		return nil, fmt.Errorf("git source needs a checkout directory, e.g. git:../cloud-infrastructure:ips.md")
+	}
+	return source, nil
+}
+
+// HTTPSource downloads ips.md from a URL.
+type HTTPSource struct {
+	URL string
+}
+
+func (s HTTPSource) String() string {
+	return s.URL
+}
+
+// Fetch downloads ips.md.
+func (s HTTPSource) Fetch() ([]byte, error) {
+	result, err := s.FetchIfChanged(util.FetchState{})
+	return result.Body, err
+}
+
+// FetchIfChanged downloads ips.md unless the server reports it is not modified
+// since previous.
+func (s HTTPSource) FetchIfChanged(previous util.FetchState) (util.FetchResult, error) {
+	logger.SystemLogger.Info(fmt.Sprintf("Getting IP ranges source from %s ", s.URL))
+
+	result, err := util.ConditionalGet(s.URL, previous)
+	if err != nil {
+		return result, fmt.Errorf("error encountered while getting IP ranges: %w", err)
+	}
+	return result, nil
+}
+
+// FileSource reads ips.md from the local file system, e.g. the vendored snapshot.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) String() string {
+	return "file:" + s.Path
+}
+
+// Fetch reads ips.md.
+func (s FileSource) Fetch() ([]byte, error) {
+	logger.SystemLogger.Info(fmt.Sprintf("Reading IP ranges source from %s ", s.Path))
+	return os.ReadFile(s.Path)
+}
+
+// GitSource reads ips.md from a local checkout of the docs repository. When
+// Revision is set the file is read at that commit, tag or branch with git show,
+// otherwise from the working tree.
+type GitSource struct {
+	Checkout string
+	Path     string
+	Revision string
+}
+
+func (s GitSource) String() string {
+	spec := "git:" + s.Checkout + ":" + s.Path
+	if s.Revision != "" {
+		spec += "@" + s.Revision
+	}
+	return spec
+}
+
+// Fetch reads ips.md from the checkout.
+func (s GitSource) Fetch() ([]byte, error) {
+	logger.SystemLogger.Info(fmt.Sprintf("Reading IP ranges source from %s ", s))
+
+	if s.Revision == "" {
+		return os.ReadFile(filepath.Join(s.Checkout, s.Path))
+	}
+
+	cmd := exec.Command("git", "-C", s.Checkout, "show", s.Revision+":"+filepath.ToSlash(s.Path))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w: %s", s, err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
@@ -1,24 +1,18 @@
 package updater
 
 import (
-	"bufio"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"os/exec"
-	"sort"
 	"strings"
 	"time"
 
+	"dprosper/calculator/internal/archive"
 	"dprosper/calculator/internal/logger"
 	"dprosper/calculator/internal/subnetcalc"
+	"dprosper/calculator/internal/util"
+	"dprosper/calculator/internal/watch"
 
-	"github.com/Jeffail/gabs/v2"
 	"go.uber.org/zap"
 )
 
@@ -27,18 +21,22 @@ type IPS struct {
 	DataCenter string
 	Pod        string
 	CidrBlocks []string
+	// Flows are the required flows listed with the table of the record.
+	Flows []subnetcalc.Flow
 }
 
 type ICIPRanges struct {
-	Name         string                  `json:"name"`
-	Type         string                  `json:"type"`
-	Version      string                  `json:"version"`
-	LastUpdated  string                  `json:"last_updated"`
-	ReleaseNotes string                  `json:"release_notes"`
-	Source       string                  `json:"source"`
-	SourceJSON   string                  `json:"source_json"`
-	Issues       string                  `json:"issues"`
-	DataCenters  []subnetcalc.DataCenter `json:"data_centers"`
+	Schema        string                  `json:"$schema"`
+	SchemaVersion string                  `json:"schema_version"`
+	Name          string                  `json:"name"`
+	Type          string                  `json:"type"`
+	Version       string                  `json:"version"`
+	LastUpdated   string                  `json:"last_updated"`
+	ReleaseNotes  string                  `json:"release_notes"`
+	Source        string                  `json:"source"`
+	SourceJSON    string                  `json:"source_json"`
+	Issues        string                  `json:"issues"`
+	DataCenters   []subnetcalc.DataCenter `json:"data_centers"`
 }
 
 type TagPicker struct {
@@ -48,323 +46,77 @@ type TagPicker struct {
 	GeoRegion string `json:"geo_region"`
 }
 
-type FrontEndNetwork struct {
-	CidrBlocks []string `json:"cidr_blocks"`
-}
-
-type LoadBalancerIP struct {
-	CidrBlocks []string `json:"cidr_blocks"`
-}
-
-type SslVpnPop struct {
-	CidrBlocks []string `json:"cidr_blocks"`
-}
-
-func removeTempFiles() {
-	e := os.Remove("ips")
-	if e != nil {
-		logger.SystemLogger.Debug("File not found", zap.String("file", "ips"))
-	}
-	e = os.Remove("ips-sorted.csv")
-	if e != nil {
-		logger.SystemLogger.Debug("File not found", zap.String("file", "ips-sorted.csv"))
-	}
-	e = os.Remove("ips.json")
-	if e != nil {
-		logger.SystemLogger.Debug("File not found", zap.String("file", "ips.json"))
-	}
-	e = os.Remove("tags.json")
-	if e != nil {
-		logger.SystemLogger.Debug("File not found", zap.String("file", "tags.json"))
-	}
-	// e = os.Remove("ips.md")
-	// if e != nil {
-	// 	logger.SystemLogger.Debug("File not found", zap.String("file", "ips.md"))
-	// }
-	e = os.Remove("cos-endpoints.json")
-	if e != nil {
-		logger.SystemLogger.Debug("File not found", zap.String("file", "cos-endpoints.json"))
-	}
-}
-
-func createDataCenters() {
-	f, err := os.Open("ips")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-
-	csvReader := csv.NewReader(f)
-	data, err := csvReader.ReadAll()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	var ips []IPS
-
-	for _, line := range data {
-		cidr := strings.Split(line[3], " ")
-
-		ips = append(ips, IPS{
-			Network:    line[0],
-			DataCenter: line[1],
-			Pod:        line[2],
-			CidrBlocks: cidr,
-		})
-
-		sort.SliceStable(ips, func(i, j int) bool {
-			return ips[i].DataCenter < ips[j].DataCenter
-		})
-	}
-
-	output, result := runCmd("diff", []string{"ips", "ips.old"})
-
-	// if output != "" {
-	logger.SystemLogger.Info("changes found since last run.",
-		zap.String("diff_output", output),
-		zap.String("run_cmd_result", result),
-	)
-
-	lastRan := time.Now().Format("20060102.150405")
-
-	// Copies ips.md to ips.<date>.md as a backup.
-	ipsMd, err := os.Open("ips.md")
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in opening file.",
-			zap.String("file: ", "ips.md"),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer ipsMd.Close()
-
-	ipsMdCopy, err := os.Create(fmt.Sprintf("ips.%s.md", lastRan))
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in creating file.",
-			zap.String("file: ", fmt.Sprintf("ips.%s.md", lastRan)),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer ipsMdCopy.Close()
-
-	_, err = io.Copy(ipsMdCopy, ipsMd)
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in copying file.",
-			zap.String("file: ", fmt.Sprintf("ips.%s.md", lastRan)),
-			zap.String("error: ", err.Error()),
-		)
-	}
-
-	// Copies ips.old to ips.<date>.old.csv as a backup.
-	ipsOld, err := os.Open("ips.old")
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in opening file.",
-			zap.String("file: ", "ips.old"),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer ipsOld.Close()
-
-	ipsOldSave, err := os.Create(fmt.Sprintf("ips.old.%s.csv", lastRan))
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in creating file.",
-			zap.String("file: ", fmt.Sprintf("ips.old.%s.csv", lastRan)),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer ipsOldSave.Close()
-
-	_, err = io.Copy(ipsOldSave, ipsOld)
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in copying file.",
-			zap.String("file: ", fmt.Sprintf("ips.old.%s.csv", lastRan)),
-			zap.String("error: ", err.Error()),
-		)
-	}
-
-	// Copies ips to ips.<date>.csv as a backup.
-	ipsCSV, err := os.Open("ips")
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in opening file.",
-			zap.String("file: ", "ips"),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer ipsCSV.Close()
-
-	ipsNew, err := os.Create(fmt.Sprintf("ips.%s.csv", lastRan))
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in creating file.",
-			zap.String("file: ", fmt.Sprintf("ips.%s.csv", lastRan)),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer ipsNew.Close()
-
-	_, err = io.Copy(ipsNew, ipsCSV)
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in copying file.",
-			zap.String("file: ", fmt.Sprintf("ips.%s.csv", lastRan)),
-			zap.String("error: ", err.Error()),
-		)
-	}
-
-	// Copies ips to ips.old
-	e := os.Remove("ips.old")
-	if e != nil {
-		fmt.Println("ips.old file not found")
-	}
-
-	ipsCSV, err = os.Open("ips")
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in opening file.",
-			zap.String("file: ", "ips"),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer ipsCSV.Close()
-
-	ipsOld2, err := os.Create("ips.old")
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in creating file.",
-			zap.String("file: ", "ips.old"),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer ipsOld2.Close()
-
-	_, err = io.Copy(ipsOld2, ipsCSV)
-	if err != nil {
-		logger.ErrorLogger.Fatal("error in copying file.",
-			zap.String("file: ", "ips.old"),
-			zap.String("error: ", err.Error()),
-		)
-	}
-
-	f, err = os.OpenFile("ips-sorted.csv", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		logger.ErrorLogger.Fatal("error opening ips-sorted.csv",
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer f.Close()
-
-	for _, value := range ips {
-		if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", value.Network, value.DataCenter, value.Pod, strings.ReplaceAll(strings.Join(value.CidrBlocks, " "), "  ", " "))); err != nil {
-			logger.ErrorLogger.Fatal("error writing ips-sorted.csv", zap.String("error: ", err.Error()))
-		}
-	}
-
-	f, err = os.OpenFile(fmt.Sprintf("ips.changes.%s", lastRan), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		logger.ErrorLogger.Fatal("error opening file",
-			zap.String("file: ", fmt.Sprintf("ips.changes.%s", lastRan)),
-			zap.String("error: ", err.Error()),
-		)
-	}
-	defer f.Close()
-
-	if _, err = f.WriteString(output); err != nil {
-		logger.ErrorLogger.Fatal("error writing file",
-			zap.String("error: ", err.Error()),
-			zap.String("file: ", fmt.Sprintf("ips.changes.%s", lastRan)),
-		)
-	}
-
-	err = exec.Command("cp", fmt.Sprintf("ips.changes.%s", lastRan), fmt.Sprintf("../data/ips.changes.%s", lastRan)).Run()
-	if err != nil {
-	}
-
-	createDataCentersJSON()
-
-	// write the ips, ips.old and ips.md
-	// write output variable to a output.csv
-	// } else {
-	// 	logger.SystemLogger.Info("no changes found since last run.",
-	// 		zap.String("diff_output", output),
-	// 		zap.String("run_cmd_result", ""),
-	// 	)
-	// }
-}
-
-func createDataCentersJSON() {
-	f, err := os.Open("ips-sorted.csv")
-	if err != nil {
-		logger.ErrorLogger.Fatal("error opening ips-sorted.csv", zap.String("error: ", err.Error()))
-	}
-	defer f.Close()
-
-	csvReader := csv.NewReader(f)
-	data, err := csvReader.ReadAll()
-	if err != nil {
-		log.Fatal(err)
-	}
-
+// createDataCentersJSON groups the sorted ips records by data center and builds
+// the data set. metadata holds the city, state, country and geo region of each
+// data center, keyed by name. rules set the RHEL and IMS ranges of each data
+// center from the service networks of other data centers.
+func createDataCentersJSON(data []IPS, metadata Metadata, rules DependencyRules, lastUpdated time.Time) (ICIPRanges, []TagPicker) {
 	var tagPicker []TagPicker
 	var dataCenters []subnetcalc.DataCenter
-	var frontEndNetworks []FrontEndNetwork
-	var loadBalancerIPs []LoadBalancerIP
+	var frontEndNetworks []subnetcalc.FrontEndPublic
+	var loadBalancerIPs []subnetcalc.LoadBalancerIP
 	var privateNetworks []subnetcalc.PrivateNetwork
 	var serviceNetwork []subnetcalc.ServiceNetwork
 	var sslVPN []subnetcalc.SslVpn
-	var sslVPNPops []SslVpnPop
+	var sslVPNPops []subnetcalc.SslVpnPop
 	var eVault []subnetcalc.Evault
 	var fileBlock []subnetcalc.FileBlock
 	var iCOS []subnetcalc.Icos
 	var advMon []subnetcalc.AdvMon
 	var rheLS []subnetcalc.RHELS
 	var ims []subnetcalc.IMS
+	var legacyNetworks []subnetcalc.LegacyNetwork
+	var windowsVsi []subnetcalc.WindowsVsi
 	var allCidr []string
-	var rhelsCidr []string
-	var imsCidr []string
-
-	icdcs, err := os.ReadFile("ibm-cloud-data-centers.json")
-	if err != nil {
-		fmt.Println("Error:", err)
-		return
-	}
-
-	jsonParsed, err := gabs.ParseJSON(icdcs)
-	if err != nil {
-		panic(err)
-	}
+	var legacyCidr []string
+	var windowsVsiCidr []string
 
 	last := "ams03"
 	for _, line := range data {
-		start := line[1]
+		start := line.DataCenter
 		// rhe_ls,any-left,,dal09
 
-		if line[0] == "service_network" && start == "all" {
-			temp := strings.Split(line[3], " ")
+		if line.Network == "service_network" && start == "all" {
+			temp := line.CidrBlocks
 			allCidr = append(allCidr, temp...)
-		} else if line[0] == "rhe_ls" && start == "any-left" {
-			temp := getServiceNetwork(line[3])
-			rhelsCidr = append(rhelsCidr, temp...)
+		} else if line.Network == "rhe_ls" && start == "any-left" {
+			// Mapped by the fallback rule of the service dependency rules.
+		} else if line.Network == "legacy_networks" && start == "all" {
+			temp := line.CidrBlocks
+			legacyCidr = append(legacyCidr, temp...)
+		} else if line.Network == "windows_vsi" && start == "all" {
+			temp := line.CidrBlocks
+			windowsVsiCidr = append(windowsVsiCidr, temp...)
 		} else {
 			if start == last {
 				last = start
 			} else {
-				city, _ := jsonParsed.Search(last, "city").Data().(string)
-				state, _ := jsonParsed.Search(last, "state").Data().(string)
-				country, _ := jsonParsed.Search(last, "country").Data().(string)
-				geoRegion, _ := jsonParsed.Search(last, "geo_region").Data().(string)
-
-				// Service Networks required for IMS: DAL10, WDC04
-				temp := getServiceNetwork("dal10")
-				imsCidr = append(imsCidr, temp...)
-				temp = getServiceNetwork("wdc04")
-				imsCidr = append(imsCidr, temp...)
-				if geoRegion == "Europe" {
-					// Also requires AMS01
-					temp = getServiceNetwork("ams03")
-					imsCidr = append(imsCidr, temp...)
+				location := metadata[last]
+				city, state, country, geoRegion := location.City, location.State, location.Country, location.GeoRegion
+
+				for _, dependency := range dependencies(data, rules, RuleServiceIMS, last, geoRegion) {
+					ims = append(ims, subnetcalc.IMS{
+						OriginDataCenter: dependency.DataCenter,
+						CidrBlocks:       dependency.CidrBlocks,
+					})
 				}
-				ims = append(ims, subnetcalc.IMS{
-					CidrBlocks: imsCidr,
-				})
 
-				if rheLS == nil {
+				for _, dependency := range dependencies(data, rules, RuleServiceRHEL, last, geoRegion) {
 					rheLS = append(rheLS, subnetcalc.RHELS{
-						CidrBlocks: rhelsCidr,
+						OriginDataCenter: dependency.DataCenter,
+						CidrBlocks:       dependency.CidrBlocks,
+					})
+				}
+
+				if legacyCidr != nil {
+					legacyNetworks = append(legacyNetworks, subnetcalc.LegacyNetwork{
+						CidrBlocks: legacyCidr,
+					})
+				}
+
+				if windowsVsiCidr != nil {
+					windowsVsi = append(windowsVsi, subnetcalc.WindowsVsi{
+						CidrBlocks: windowsVsiCidr,
 					})
 				}
 
@@ -443,6 +195,28 @@ func createDataCentersJSON() {
 					}
 				}
 
+				for _, sslVpnPop := range sslVPNPops {
+					for _, cloudCidr := range sslVpnPop.CidrBlocks {
+						cloudDetails := subnetcalc.GetSubnetDetailsV2(cloudCidr)
+
+						cloudCidrNetwork := subnetcalc.CidrNetwork{
+							Service:             subnetcalc.ServiceSslVpnPop,
+							CidrNotation:        cloudDetails.CidrNotation,
+							SubnetBits:          cloudDetails.SubnetBits,
+							SubnetMask:          cloudDetails.SubnetMask,
+							WildcardMask:        cloudDetails.WildcardMask,
+							NetworkAddress:      cloudDetails.NetworkAddress,
+							BroadcastAddress:    cloudDetails.BroadcastAddress,
+							AssignableHosts:     cloudDetails.AssignableHosts,
+							FirstAssignableHost: cloudDetails.FirstAssignableHost,
+							LastAssignableHost:  cloudDetails.LastAssignableHost,
+							Conflict:            false,
+						}
+
+						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+					}
+				}
+
 				for _, evault := range eVault {
 					for _, cloudCidr := range evault.CidrBlocks {
 						cloudDetails := subnetcalc.GetSubnetDetailsV2(cloudCidr)
@@ -459,6 +233,7 @@ func createDataCentersJSON() {
 							FirstAssignableHost: cloudDetails.FirstAssignableHost,
 							LastAssignableHost:  cloudDetails.LastAssignableHost,
 							Conflict:            false,
+							Flows:               evault.Flows,
 						}
 
 						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -481,6 +256,7 @@ func createDataCentersJSON() {
 							FirstAssignableHost: cloudDetails.FirstAssignableHost,
 							LastAssignableHost:  cloudDetails.LastAssignableHost,
 							Conflict:            false,
+							Flows:               icos.Flows,
 						}
 
 						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -503,6 +279,7 @@ func createDataCentersJSON() {
 							FirstAssignableHost: cloudDetails.FirstAssignableHost,
 							LastAssignableHost:  cloudDetails.LastAssignableHost,
 							Conflict:            false,
+							Flows:               fileblock.Flows,
 						}
 
 						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -525,6 +302,7 @@ func createDataCentersJSON() {
 							FirstAssignableHost: cloudDetails.FirstAssignableHost,
 							LastAssignableHost:  cloudDetails.LastAssignableHost,
 							Conflict:            false,
+							Flows:               advmon.Flows,
 						}
 
 						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -547,6 +325,7 @@ func createDataCentersJSON() {
 							FirstAssignableHost: cloudDetails.FirstAssignableHost,
 							LastAssignableHost:  cloudDetails.LastAssignableHost,
 							Conflict:            false,
+							OriginDataCenter:    rhels.OriginDataCenter,
 						}
 
 						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -569,6 +348,51 @@ func createDataCentersJSON() {
 							FirstAssignableHost: cloudDetails.FirstAssignableHost,
 							LastAssignableHost:  cloudDetails.LastAssignableHost,
 							Conflict:            false,
+							OriginDataCenter:    ims.OriginDataCenter,
+						}
+
+						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+					}
+				}
+
+				for _, legacyNetwork := range legacyNetworks {
+					for _, cloudCidr := range legacyNetwork.CidrBlocks {
+						cloudDetails := subnetcalc.GetSubnetDetailsV2(cloudCidr)
+
+						cloudCidrNetwork := subnetcalc.CidrNetwork{
+							Service:             subnetcalc.ServiceLegacyNetwork,
+							CidrNotation:        cloudDetails.CidrNotation,
+							SubnetBits:          cloudDetails.SubnetBits,
+							SubnetMask:          cloudDetails.SubnetMask,
+							WildcardMask:        cloudDetails.WildcardMask,
+							NetworkAddress:      cloudDetails.NetworkAddress,
+							BroadcastAddress:    cloudDetails.BroadcastAddress,
+							AssignableHosts:     cloudDetails.AssignableHosts,
+							FirstAssignableHost: cloudDetails.FirstAssignableHost,
+							LastAssignableHost:  cloudDetails.LastAssignableHost,
+							Conflict:            false,
+						}
+
+						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+					}
+				}
+
+				for _, windows := range windowsVsi {
+					for _, cloudCidr := range windows.CidrBlocks {
+						cloudDetails := subnetcalc.GetSubnetDetailsV2(cloudCidr)
+
+						cloudCidrNetwork := subnetcalc.CidrNetwork{
+							Service:             subnetcalc.ServiceWindowsVsi,
+							CidrNotation:        cloudDetails.CidrNotation,
+							SubnetBits:          cloudDetails.SubnetBits,
+							SubnetMask:          cloudDetails.SubnetMask,
+							WildcardMask:        cloudDetails.WildcardMask,
+							NetworkAddress:      cloudDetails.NetworkAddress,
+							BroadcastAddress:    cloudDetails.BroadcastAddress,
+							AssignableHosts:     cloudDetails.AssignableHosts,
+							FirstAssignableHost: cloudDetails.FirstAssignableHost,
+							LastAssignableHost:  cloudDetails.LastAssignableHost,
+							Conflict:            false,
 						}
 
 						cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -582,20 +406,24 @@ func createDataCentersJSON() {
 					State:           state,
 					Country:         country,
 					GeoRegion:       geoRegion,
+					Status:          location.Status,
+					ClosureDate:     location.ClosureDate,
+					FrontEndPublic:  frontEndNetworks,
+					LoadBalancerIPs: loadBalancerIPs,
 					PrivateNetworks: privateNetworks,
 					ServiceNetwork:  serviceNetwork,
 					SslVpn:          sslVPN,
+					SslVpnPops:      sslVPNPops,
 					Evault:          eVault,
 					Icos:            iCOS,
 					FileBlock:       fileBlock,
 					AdvMon:          advMon,
 					RHELS:           rheLS,
 					IMS:             ims,
-					// FrontEndNetworks: frontEndNetworks,
-					// LoadBalancerIPs:  loadBalancerIPs,
-					// SslVpnPops:       sslVPNPops,
-					CidrNetworks: cloudCidrNetworks,
-					Conflict:     false,
+					LegacyNetworks:  legacyNetworks,
+					WindowsVsi:      windowsVsi,
+					CidrNetworks:    cloudCidrNetworks,
+					Conflict:        false,
 				})
 
 				frontEndNetworks = nil
@@ -610,96 +438,123 @@ func createDataCentersJSON() {
 				advMon = nil
 				rheLS = nil
 				ims = nil
-				imsCidr = nil
+				legacyNetworks = nil
+				windowsVsi = nil
 
 				last = start
 			}
 
-			cidr := strings.Split(strings.ReplaceAll(line[3], "  ", " "), " ")
+			cidr := append([]string{}, line.CidrBlocks...)
 
-			if line[0] == "front_end_public_network" {
-				frontEndNetworks = append(frontEndNetworks, FrontEndNetwork{
+			if line.Network == "front_end_public_network" {
+				frontEndNetworks = append(frontEndNetworks, subnetcalc.FrontEndPublic{
 					CidrBlocks: cidr,
 				})
 			}
 
-			if line[0] == "load_balancers_ips" {
-				loadBalancerIPs = append(loadBalancerIPs, LoadBalancerIP{
+			if line.Network == "load_balancers_ips" {
+				loadBalancerIPs = append(loadBalancerIPs, subnetcalc.LoadBalancerIP{
 					CidrBlocks: cidr,
 				})
 			}
 
-			if line[0] == "service_network" {
+			if line.Network == "service_network" {
 				cidr = append(cidr, allCidr...)
 				serviceNetwork = append(serviceNetwork, subnetcalc.ServiceNetwork{
 					CidrBlocks: cidr,
 				})
 			}
 
-			if line[0] == "private_networks" {
+			if line.Network == "private_networks" {
 				privateNetworks = append(privateNetworks, subnetcalc.PrivateNetwork{
-					Key:        line[2],
-					Name:       line[2],
-					CidrBlocks: cidr,
-				})
-			}
-
-			if line[0] == "service_network" {
-				cidr = append(cidr, allCidr...)
-				serviceNetwork = append(serviceNetwork, subnetcalc.ServiceNetwork{
+					Key:        line.Pod,
+					Name:       line.Pod,
 					CidrBlocks: cidr,
 				})
 			}
 
-			if line[0] == "ssl_vpn" {
+			if line.Network == "ssl_vpn" {
 				sslVPN = append(sslVPN, subnetcalc.SslVpn{
 					CidrBlocks: cidr,
 				})
 			}
 
-			if line[0] == "ssl_vpn_pops" {
-				sslVPNPops = append(sslVPNPops, SslVpnPop{
+			if line.Network == "ssl_vpn_pops" {
+				sslVPNPops = append(sslVPNPops, subnetcalc.SslVpnPop{
 					CidrBlocks: cidr,
 				})
 			}
 
-			if line[0] == "evault" {
+			if line.Network == "evault" {
 				eVault = append(eVault, subnetcalc.Evault{
 					CidrBlocks: cidr,
+					Flows:      line.Flows,
 				})
 			}
 
-			if line[0] == "file_block" {
+			if line.Network == "file_block" {
 				fileBlock = append(fileBlock, subnetcalc.FileBlock{
 					CidrBlocks: cidr,
+					Flows:      line.Flows,
 				})
 			}
 
-			if line[0] == "icos" {
+			if line.Network == "icos" {
 				iCOS = append(iCOS, subnetcalc.Icos{
 					CidrBlocks: cidr,
+					Flows:      line.Flows,
 				})
 			}
 
-			if line[0] == "advmon" {
+			if line.Network == "advmon" {
 				advMon = append(advMon, subnetcalc.AdvMon{
 					CidrBlocks: cidr,
+					Flows:      line.Flows,
 				})
 			}
 
-			if line[0] == "rhe_ls" {
-				cidr = getServiceNetwork(line[1])
-				rheLS = append(rheLS, subnetcalc.RHELS{
+			if line.Network == "legacy_networks" {
+				legacyNetworks = append(legacyNetworks, subnetcalc.LegacyNetwork{
+					CidrBlocks: cidr,
+				})
+			}
+
+			if line.Network == "windows_vsi" {
+				windowsVsi = append(windowsVsi, subnetcalc.WindowsVsi{
 					CidrBlocks: cidr,
 				})
 			}
 		}
 	}
 
-	city, _ := jsonParsed.Search(last, "city").Data().(string)
-	state, _ := jsonParsed.Search(last, "state").Data().(string)
-	country, _ := jsonParsed.Search(last, "country").Data().(string)
-	geoRegion, _ := jsonParsed.Search(last, "geo_region").Data().(string)
+	location := metadata[last]
+	city, state, country, geoRegion := location.City, location.State, location.Country, location.GeoRegion
+
+	for _, dependency := range dependencies(data, rules, RuleServiceIMS, last, geoRegion) {
+		ims = append(ims, subnetcalc.IMS{
+			OriginDataCenter: dependency.DataCenter,
+			CidrBlocks:       dependency.CidrBlocks,
+		})
+	}
+
+	for _, dependency := range dependencies(data, rules, RuleServiceRHEL, last, geoRegion) {
+		rheLS = append(rheLS, subnetcalc.RHELS{
+			OriginDataCenter: dependency.DataCenter,
+			CidrBlocks:       dependency.CidrBlocks,
+		})
+	}
+
+	if legacyCidr != nil {
+		legacyNetworks = append(legacyNetworks, subnetcalc.LegacyNetwork{
+			CidrBlocks: legacyCidr,
+		})
+	}
+
+	if windowsVsiCidr != nil {
+		windowsVsi = append(windowsVsi, subnetcalc.WindowsVsi{
+			CidrBlocks: windowsVsiCidr,
+		})
+	}
 
 	tagPicker = append(tagPicker, TagPicker{
 		Key:       last,
@@ -775,6 +630,28 @@ func createDataCentersJSON() {
 		}
 	}
 
+	for _, sslVpnPop := range sslVPNPops {
+		for _, cloudCidr := range sslVpnPop.CidrBlocks {
+			cloudDetails := subnetcalc.GetSubnetDetailsV2(cloudCidr)
+
+			cloudCidrNetwork := subnetcalc.CidrNetwork{
+				Service:             subnetcalc.ServiceSslVpnPop,
+				CidrNotation:        cloudDetails.CidrNotation,
+				SubnetBits:          cloudDetails.SubnetBits,
+				SubnetMask:          cloudDetails.SubnetMask,
+				WildcardMask:        cloudDetails.WildcardMask,
+				NetworkAddress:      cloudDetails.NetworkAddress,
+				BroadcastAddress:    cloudDetails.BroadcastAddress,
+				AssignableHosts:     cloudDetails.AssignableHosts,
+				FirstAssignableHost: cloudDetails.FirstAssignableHost,
+				LastAssignableHost:  cloudDetails.LastAssignableHost,
+				Conflict:            false,
+			}
+
+			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+		}
+	}
+
 	for _, evault := range eVault {
 		for _, cloudCidr := range evault.CidrBlocks {
 			cloudDetails := subnetcalc.GetSubnetDetailsV2(cloudCidr)
@@ -791,6 +668,7 @@ func createDataCentersJSON() {
 				FirstAssignableHost: cloudDetails.FirstAssignableHost,
 				LastAssignableHost:  cloudDetails.LastAssignableHost,
 				Conflict:            false,
+				Flows:               evault.Flows,
 			}
 
 			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -813,6 +691,7 @@ func createDataCentersJSON() {
 				FirstAssignableHost: cloudDetails.FirstAssignableHost,
 				LastAssignableHost:  cloudDetails.LastAssignableHost,
 				Conflict:            false,
+				Flows:               icos.Flows,
 			}
 
 			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -835,6 +714,7 @@ func createDataCentersJSON() {
 				FirstAssignableHost: cloudDetails.FirstAssignableHost,
 				LastAssignableHost:  cloudDetails.LastAssignableHost,
 				Conflict:            false,
+				Flows:               fileblock.Flows,
 			}
 
 			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -857,6 +737,7 @@ func createDataCentersJSON() {
 				FirstAssignableHost: cloudDetails.FirstAssignableHost,
 				LastAssignableHost:  cloudDetails.LastAssignableHost,
 				Conflict:            false,
+				Flows:               advmon.Flows,
 			}
 
 			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -879,6 +760,7 @@ func createDataCentersJSON() {
 				FirstAssignableHost: cloudDetails.FirstAssignableHost,
 				LastAssignableHost:  cloudDetails.LastAssignableHost,
 				Conflict:            false,
+				OriginDataCenter:    rhels.OriginDataCenter,
 			}
 
 			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -901,6 +783,51 @@ func createDataCentersJSON() {
 				FirstAssignableHost: cloudDetails.FirstAssignableHost,
 				LastAssignableHost:  cloudDetails.LastAssignableHost,
 				Conflict:            false,
+				OriginDataCenter:    ims.OriginDataCenter,
+			}
+
+			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+		}
+	}
+
+	for _, legacyNetwork := range legacyNetworks {
+		for _, cloudCidr := range legacyNetwork.CidrBlocks {
+			cloudDetails := subnetcalc.GetSubnetDetailsV2(cloudCidr)
+
+			cloudCidrNetwork := subnetcalc.CidrNetwork{
+				Service:             subnetcalc.ServiceLegacyNetwork,
+				CidrNotation:        cloudDetails.CidrNotation,
+				SubnetBits:          cloudDetails.SubnetBits,
+				SubnetMask:          cloudDetails.SubnetMask,
+				WildcardMask:        cloudDetails.WildcardMask,
+				NetworkAddress:      cloudDetails.NetworkAddress,
+				BroadcastAddress:    cloudDetails.BroadcastAddress,
+				AssignableHosts:     cloudDetails.AssignableHosts,
+				FirstAssignableHost: cloudDetails.FirstAssignableHost,
+				LastAssignableHost:  cloudDetails.LastAssignableHost,
+				Conflict:            false,
+			}
+
+			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
+		}
+	}
+
+	for _, windows := range windowsVsi {
+		for _, cloudCidr := range windows.CidrBlocks {
+			cloudDetails := subnetcalc.GetSubnetDetailsV2(cloudCidr)
+
+			cloudCidrNetwork := subnetcalc.CidrNetwork{
+				Service:             subnetcalc.ServiceWindowsVsi,
+				CidrNotation:        cloudDetails.CidrNotation,
+				SubnetBits:          cloudDetails.SubnetBits,
+				SubnetMask:          cloudDetails.SubnetMask,
+				WildcardMask:        cloudDetails.WildcardMask,
+				NetworkAddress:      cloudDetails.NetworkAddress,
+				BroadcastAddress:    cloudDetails.BroadcastAddress,
+				AssignableHosts:     cloudDetails.AssignableHosts,
+				FirstAssignableHost: cloudDetails.FirstAssignableHost,
+				LastAssignableHost:  cloudDetails.LastAssignableHost,
+				Conflict:            false,
 			}
 
 			cloudCidrNetworks = append(cloudCidrNetworks, cloudCidrNetwork)
@@ -914,310 +841,142 @@ func createDataCentersJSON() {
 		State:           state,
 		Country:         country,
 		GeoRegion:       geoRegion,
+		Status:          location.Status,
+		ClosureDate:     location.ClosureDate,
+		FrontEndPublic:  frontEndNetworks,
+		LoadBalancerIPs: loadBalancerIPs,
 		PrivateNetworks: privateNetworks,
 		ServiceNetwork:  serviceNetwork,
 		SslVpn:          sslVPN,
+		SslVpnPops:      sslVPNPops,
 		Evault:          eVault,
 		Icos:            iCOS,
 		FileBlock:       fileBlock,
 		AdvMon:          advMon,
 		RHELS:           rheLS,
 		IMS:             ims,
-		// FrontEndNetworks: frontEndNetworks,
-		// LoadBalancerIPs:  loadBalancerIPs,
-		// SslVpnPops:       sslVPNPops,
-		CidrNetworks: cloudCidrNetworks,
-		Conflict:     false,
+		LegacyNetworks:  legacyNetworks,
+		WindowsVsi:      windowsVsi,
+		CidrNetworks:    cloudCidrNetworks,
+		Conflict:        false,
 	})
 
-	lastUpdated := time.Now().Format("01/02/2006")
-
 	fullObject := ICIPRanges{
-		Name:         "IBM Cloud IP ranges",
-		Type:         "classic_data_center_cidr",
-		Version:      "3.0.2",
-		LastUpdated:  lastUpdated,
-		ReleaseNotes: "https://github.com/dprosper/cidr-calculator/blob/main/docs/history.md",
-		Source:       "https://cloud.ibm.com/docs/cloud-infrastructure?topic=cloud-infrastructure-ibm-cloud-ip-ranges",
-		SourceJSON:   "https://raw.githubusercontent.com/dprosper/cidr-calculator/main/data/datacenters.json",
-		Issues:       "https://github.com/dprosper/cidr-calculator/issues/new/choose",
-		DataCenters:  dataCenters,
-	}
-
-	jsonData, err := json.MarshalIndent(fullObject, "", "  ")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	f, err = os.OpenFile("ips.json", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	if _, err = f.WriteString(string(jsonData)); err != nil {
-		panic(err)
-	}
-
-	jsonData, err = json.MarshalIndent(tagPicker, "", "  ")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	f, err = os.OpenFile("tags.json", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	if _, err = f.WriteString(string(jsonData)); err != nil {
-		panic(err)
-	}
+		Schema:        subnetcalc.SchemaURL,
+		SchemaVersion: subnetcalc.SchemaVersion,
+		Name:          "IBM Cloud IP ranges",
+		Type:          subnetcalc.DatasetType,
+		Version:       subnetcalc.SchemaVersion,
+		LastUpdated:   lastUpdated.Format("01/02/2006"),
+		ReleaseNotes:  "https://github.com/dprosper/cidr-calculator/blob/main/docs/history.md",
+		Source:        "https://cloud.ibm.com/docs/cloud-infrastructure?topic=cloud-infrastructure-ibm-cloud-ip-ranges",
+		SourceJSON:    "https://raw.githubusercontent.com/dprosper/cidr-calculator/main/data/datacenters.json",
+		Issues:        "https://github.com/dprosper/cidr-calculator/issues/new/choose",
+		DataCenters:   dataCenters,
+	}
+
+	return fullObject, tagPicker
 }
 
-func parseFEN(content string) {
-	arr := strings.Split(content, "|")
-
-	city := strings.TrimSpace(arr[2])
-	if city != "---" && strings.ToLower(city) != "city" {
-
-		dataCenter := strings.TrimSpace(arr[1])
-
-		ipRange := strings.TrimSpace(arr[3])
-
-		ips := strings.Split(ipRange, `\n`)
-
-		f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-
-		if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", "front_end_public_network", strings.ToLower(dataCenter), "", strings.Join(strings.Fields(strings.Join(ips, " ")), " "))); err != nil {
-			panic(err)
-		}
+// newIPS builds an ips record. CIDR blocks are space separated.
+func newIPS(network string, dataCenter string, pod string, cidrBlocks string) IPS {
+	return IPS{
+		Network:    network,
+		DataCenter: strings.ToLower(dataCenter),
+		Pod:        strings.ToLower(pod),
+		CidrBlocks: strings.Fields(cidrBlocks),
 	}
 }
 
-func parseLBIPS(content string) {
-	arr := strings.Split(content, "|")
-
-	city := strings.TrimSpace(arr[2])
-	if city != "---" && strings.ToLower(city) != "city" {
-
-		dataCenter := strings.TrimSpace(arr[1])
-
-		ipRange := strings.TrimSpace(arr[3])
-
-		ips := strings.Split(ipRange, `\n`)
-
-		f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-
-		if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", "load_balancers_ips", strings.ToLower(dataCenter), "", strings.Join(strings.Fields(strings.Join(ips, " ")), " "))); err != nil {
-			panic(err)
-		}
-	}
+func parseFEN(row Row) []IPS {
+	return []IPS{newIPS("front_end_public_network", row.Get("data center"), "", cidrList(row.Get("ip range")))}
 }
 
-func getServiceNetwork(dataCenter string) (cidr []string) {
-	f, err := os.Open("ips")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-
-	csvReader := csv.NewReader(f)
-	data, err := csvReader.ReadAll()
-	if err != nil {
-		log.Fatal(err)
-	}
+func parseLBIPS(row Row) []IPS {
+	return []IPS{newIPS("load_balancers_ips", row.Get("data center"), "", cidrList(row.Get("ip range")))}
+}
 
-	for _, line := range data {
-		if line[0] == "service_network" && line[1] == dataCenter {
-			return strings.Split(line[3], " ")
+func getServiceNetwork(ips []IPS, dataCenter string) (cidr []string) {
+	for _, line := range ips {
+		if line.Network == "service_network" && line.DataCenter == dataCenter {
+			return append(cidr, line.CidrBlocks...)
 		}
 	}
 
 	return
 }
 
-func parseCPNS(content string) {
-	arr := strings.Split(content, "|")
-
-	city := strings.TrimSpace(arr[1])
-	if city != "---" && strings.ToLower(city) != "city" {
-		dataCenter := strings.TrimSpace(arr[2])
-
-		pod := strings.TrimSpace(arr[3])
-
-		ipRange := strings.TrimSpace(arr[4])
-
-		ips := strings.Split(ipRange, `\n`)
-
-		f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-
-		if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", "private_networks", strings.ToLower(dataCenter), strings.ToLower(pod), strings.Join(strings.Fields(strings.Join(ips, " ")), " "))); err != nil {
-			panic(err)
-		}
-	}
+func parseCPNS(row Row) []IPS {
+	return []IPS{newIPS("private_networks", row.Get("data center"), row.Get("pod"), cidrList(row.Get("ip range")))}
 }
 
-func parseSN(content string) {
-	arr := strings.Split(content, "|")
-
-	city := strings.TrimSpace(arr[2])
-	if city != "---" && strings.ToLower(city) != "city" {
-
-		dataCenter := strings.TrimSpace(arr[1])
-
-		ipRange := strings.TrimSpace(arr[3])
-
-		ips := strings.Split(strings.ReplaceAll(ipRange, "[^fn1]", ""), ` \n `)
-
-		f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-
-		if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", "service_network", strings.ToLower(dataCenter), "", strings.Join(strings.Fields(strings.Join(ips, " ")), " "))); err != nil {
-			panic(err)
-		}
-	}
+func parseSN(row Row) []IPS {
+	return []IPS{newIPS("service_network", row.Get("data center"), "", cidrList(row.Get("ip range")))}
 }
 
-func parseSDC(content string, nextService string) {
-	arr := strings.Split(content, "|")
+func parseSDC(row Row, service string) []IPS {
+	return []IPS{newIPS(service, row.Get("data center"), "", cidrList(row.Get("ip range")))}
+}
 
-	dataCenter := strings.TrimSpace(arr[1])
-	if dataCenter != "-----" && strings.ToLower(dataCenter) != "data center" && !strings.Contains(dataCenter, "**Required Flows**") {
+func parseSSLVPN(row Row) []IPS {
+	return []IPS{newIPS("ssl_vpn", row.Get("data center"), "", cidrList(row.Get("ip range")))}
+}
 
-		ipRange := strings.TrimSpace(arr[2])
+func parseSSLVPNPOPS(row Row) []IPS {
+	return []IPS{newIPS("ssl_vpn_pops", row.Get("data center"), "", cidrList(row.Get("ip range")))}
+}
 
-		ips := strings.Split(ipRange, `\n`)
+func parseRHELS(row Row) []IPS {
+	/*
+		- Loop through this list in the parentheses and extract the dataCenter
+		|Amsterdam (ams01, ams03)|fra02|
+		- Read the second column which is a dataCenter name and search for its servicenetwork and add to the csv file.
+		- add a RHEL tab/section to the UI
+	*/
+	location := row.Get("location")
+	serviceDataCenter := row.Get("data center")
 
-		f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
+	if strings.ToLower(location) == "any data center not listed" {
+		return []IPS{newIPS("rhe_ls", "any-left", "", strings.ToLower(serviceDataCenter))}
+	}
 
-		if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", nextService, strings.ToLower(dataCenter), "", strings.Join(strings.Fields(strings.Join(ips, " ")), " "))); err != nil {
-			panic(err)
-		}
+	var ips []IPS
+	for _, dataCenter := range strings.Split(GetStringInBetweenTwoString(location, "(", ")"), ",") {
+		ips = append(ips, newIPS("rhe_ls", strings.TrimSpace(dataCenter), "", strings.ToLower(serviceDataCenter)))
 	}
+	return ips
 }
 
-func parseSSLVPN(content string) {
-	arr := strings.Split(content, "|")
-
-	city := strings.TrimSpace(arr[2])
-	if city != "---" && strings.ToLower(city) != "city" {
-
-		dataCenter := strings.TrimSpace(arr[1])
-
-		ipRange := strings.TrimSpace(arr[3])
-
-		ips := strings.Split(ipRange, `\n`)
-
-		f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-
-		if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", "ssl_vpn", strings.ToLower(dataCenter), "", strings.Join(strings.Fields(strings.Join(ips, " ")), " "))); err != nil {
-			panic(err)
-		}
+func parseLegacyNetworks(row Row) []IPS {
+	var ips []IPS
+	for _, dataCenter := range dataCenterList(row.Get("data center")) {
+		ips = append(ips, newIPS("legacy_networks", dataCenter, "", cidrList(row.Get("ip range"))))
 	}
+	return ips
 }
 
-func parseSSLVPNPOPS(content string) {
-	arr := strings.Split(content, "|")
-
-	city := strings.TrimSpace(arr[2])
-
-	if city != "---" && strings.ToLower(city) != "city" {
-
-		dataCenter := strings.TrimSpace(arr[1])
-		ipRange := strings.TrimSpace(arr[3])
-
-		ips := strings.Split(ipRange, `\n`)
-
-		f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-
-		if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", "ssl_vpn_pops", strings.ToLower(dataCenter), "", strings.Join(strings.Fields(strings.Join(ips, " ")), " "))); err != nil {
-			panic(err)
-		}
+func parseWindowsVSI(row Row) []IPS {
+	var ips []IPS
+	for _, dataCenter := range dataCenterList(row.Get("data center")) {
+		ips = append(ips, newIPS("windows_vsi", dataCenter, "", cidrList(row.Get("ip range"))))
 	}
+	return ips
 }
 
-func parseRHELS(content string) {
-	arr := strings.Split(content, "|")
-
-	location := strings.TrimSpace(arr[1])
-	if location != "---" && strings.ToLower(location) != "server location" {
-		/*
-			- Loop through this list in the parentheses and extract the dataCenter
-			|Amsterdam (ams01, ams03)|fra02|
-			- Read the second column which is a dataCenter name and search for its servicenetwork and add to the csv file.
-			- add a RHEL tab/section to the UI
-		*/
-
-		if strings.ToLower(location) == "any data center not listed" {
-			dataCenter := "any-left"
-			serviceDataCenter := strings.TrimSpace(arr[2])
-
-			f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-			if err != nil {
-				panic(err)
-			}
-			defer f.Close()
-
-			if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", "rhe_ls", strings.ToLower(strings.TrimSpace(dataCenter)), "", strings.ToLower(serviceDataCenter))); err != nil {
-				panic(err)
-			}
-
-		} else {
-			dcs := strings.Split(GetStringInBetweenTwoString(location, "(", ")"), ",")
-
-			serviceDataCenter := strings.TrimSpace(arr[2])
-
-			f, err := os.OpenFile("ips", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-			if err != nil {
-				panic(err)
-			}
-			defer f.Close()
+// dataCenterList splits a data center cell such as "DAL10, DAL12" into its data
+// centers. A cell such as "All data centers" becomes "all".
+func dataCenterList(cell string) []string {
+	if strings.HasPrefix(strings.ToLower(cell), "all") {
+		return []string{"all"}
+	}
 
-			for _, dataCenter := range dcs {
-				if _, err = f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", "rhe_ls", strings.ToLower(strings.TrimSpace(dataCenter)), "", strings.ToLower(serviceDataCenter))); err != nil {
-					panic(err)
-				}
-			}
+	var dataCenters []string
+	for _, dataCenter := range strings.Split(cell, ",") {
+		if dataCenter = strings.TrimSpace(dataCenter); dataCenter != "" {
+			dataCenters = append(dataCenters, dataCenter)
 		}
-
 	}
-}
-
-func runCmd(name string, args []string) (output string, result string) {
-	out, err := exec.Command(name, args...).Output()
-	result = fmt.Sprintf("%s", err)
-
-	output = string(out[:])
-
-	return
+	return dataCenters
 }
 
 func GetStringInBetweenTwoString(str string, startS string, endS string) (result string) {
@@ -1234,139 +993,259 @@ func GetStringInBetweenTwoString(str string, startS string, endS string) (result
 	return result
 }
 
-// getIPRangesMD function
-func getIPRangesMD(requestURL string) {
-	url1, err := url.ParseRequestURI(requestURL)
-	if err != nil || url1.Scheme == "" {
-		logger.ErrorLogger.Fatal(fmt.Sprintf("found an error: %v", err))
-	}
-
-	logger.SystemLogger.Info(fmt.Sprintf("Getting IP ranges source from %s ", requestURL))
+// saveIPRanges archives the data set of r with its source markdown, diff and
+// changelog in ../data/versions, then promotes it to ../data/datacenters.json
+// and applies the retention policy. The changelog entry is added to
+// ../docs/history.md when something changed. Every file is written atomically.
+func saveIPRanges(markdown []byte, r release, diff DatasetDiff, source string, retention archive.Retention) error {
+	a := archive.Open(ArchiveDir)
 
-	httpRequest, _ := http.NewRequest("GET", requestURL, nil)
-	httpRequest.Header.Set("User-Agent", "cidr-calculator (dimitri.prosper@gmail.com)")
-	httpRequest.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if err := archiveRelease(a, r, source, markdown); err != nil {
+		return fmt.Errorf("error archiving version %s: %w", r.stamp, err)
+	}
 
-	httpClient := &http.Client{
-		Timeout: time.Duration(30 * time.Second),
+	if !diff.Empty() {
+		history, err := os.ReadFile("../docs/history.md")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := util.WriteFileAtomic("../docs/history.md", prependChangelog(history, string(r.changelog)), 0644); err != nil {
+			return fmt.Errorf("error writing ../docs/history.md: %w", err)
+		}
 	}
 
-	httpResponse, err := httpClient.Do(httpRequest)
+	// The version being replaced and the one a rollback restores stay in the
+	// archive even when the retention would remove them.
+	replaced, err := currentVersion(a)
 	if err != nil {
-		logger.ErrorLogger.Fatal(fmt.Sprintf("Error encountered while getting IP ranges: %v", err))
+		return err
+	}
+	target, err := previousVersion(a, r.stamp)
+	if err != nil {
+		return err
 	}
-	defer httpResponse.Body.Close()
-
-	logger.SystemLogger.Info(fmt.Sprintf("Get IP ranges response received: %s", httpResponse.Status))
 
-	if httpResponse.StatusCode >= 200 && httpResponse.StatusCode < 300 {
-		body, _ := io.ReadAll(httpResponse.Body)
-		err = os.WriteFile("ips.md", body, 0644)
-		if err != nil {
-			panic(err)
-		}
+	if err := util.WriteFileAtomic(DatasetPath, r.dataset, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", DatasetPath, err)
 	}
 
-	if httpResponse.StatusCode >= 300 {
-		logger.ErrorLogger.Fatal(fmt.Sprintf("Failed to get IP ranges: %s", httpResponse.Status))
+	removed, err := a.Prune(retention, r.stamp, replaced, target)
+	if err != nil {
+		return fmt.Errorf("error applying the archive retention: %w", err)
+	}
+	for _, version := range removed {
+		logger.SystemLogger.Info("removed archived version", zap.String("version", version.ID))
 	}
-}
 
-func UpdateIPRanges() {
-	removeTempFiles()
+	return nil
+}
 
-	sourcemdRaw := "https://raw.githubusercontent.com/ibm-cloud-docs/cloud-infrastructure/master/ips.md"
+// StatePath keeps the validators and hashes of the previous run, relative to
+// the backend-job directory.
+const StatePath = "ips.state.json"
 
-	getIPRangesMD(sourcemdRaw)
+// sourceState is what StatePath holds.
+type sourceState struct {
+	Source         string          `json:"source"`
+	Fetch          util.FetchState `json:"fetch"`
+	MetadataSHA256 string          `json:"metadata_sha256"`
+	RulesSHA256    string          `json:"rules_sha256"`
+}
 
-	f, _ := os.Open("ips.md")
-	defer f.Close()
+// UpdateOptions configures UpdateIPRanges.
+type UpdateOptions struct {
+	Source Source
+	// SaveSnapshot replaces the vendored snapshot with the fetched ips.md, to pin
+	// offline runs to this docs revision.
+	SaveSnapshot bool
+	// Force rebuilds the data set even when the source and metadata did not change.
+	Force bool
+	// Store, when set, receives the data set, diff and changelog of each version.
+	Store ObjectStore
+	// Retention decides which archived versions are kept.
+	Retention archive.Retention
+	// Notifiers are told about each published version.
+	Notifiers []Notifier
+	// Watched are our own CIDRs, new overlaps with the data set are reported.
+	Watched watch.Registry
+	// AllowMissingMetadata publishes data centers that have no city or geo
+	// region in MetadataPath.
+	AllowMissingMetadata bool
+	// NoPrivateNetworks are the data centers published without private
+	// networks, such as service endpoint or SSL VPN PoP locations.
+	NoPrivateNetworks []string
+}
 
-	scanner := bufio.NewScanner(f)
-	var ipType string
-	nextService := "evault"
+// UpdateIPRanges builds the data set from the ips.md of options.Source, validates
+// it and publishes it to ../data. It reports whether the data set changed,
+// nothing is written when it did not.
+func UpdateIPRanges(options UpdateOptions) (bool, error) {
+	var state sourceState
+	if data, err := os.ReadFile(StatePath); err == nil && !options.Force {
+		if err := json.Unmarshal(data, &state); err != nil {
+			logger.SystemLogger.Warn("ignoring unreadable state file.", zap.String("error: ", err.Error()))
+		}
+		if state.Source != options.Source.String() {
+			state = sourceState{}
+		}
+	}
 
-	for i := 0; scanner.Scan(); i++ {
+	metadata, err := os.ReadFile(MetadataPath)
+	if err != nil {
+		return false, fmt.Errorf("error in opening file %s: %w", MetadataPath, err)
+	}
+	metadataHash := util.SHA256(metadata)
 
-		line := scanner.Text()
+	rules, err := os.ReadFile(RulesPath)
+	if err != nil {
+		return false, fmt.Errorf("error in opening file %s: %w", RulesPath, err)
+	}
+	rulesHash := util.SHA256(rules)
 
-		switch line {
-		case "{: #front-end-network}":
-			ipType = "front-end-network"
+	fetched, err := fetchSource(options.Source, state.Fetch)
+	if err != nil {
+		return false, fmt.Errorf("error getting ips.md from %s: %w", options.Source, err)
+	}
 
-		case "{: #load-balancer-ips}":
-			ipType = "load-balancer-ips"
+	if fetched.Unchanged && metadataHash == state.MetadataSHA256 && rulesHash == state.RulesSHA256 {
+		logger.SystemLogger.Info("ips.md, the data center metadata and the dependency rules are unchanged since last run.",
+			zap.Bool("not_modified", fetched.NotModified),
+		)
+		// A 200 with the same content can still carry a new ETag or
+		// Last-Modified, keep them so the next run can get a 304.
+		if fetched.State != state.Fetch {
+			return false, saveSourceState(sourceState{Source: options.Source.String(), Fetch: fetched.State, MetadataSHA256: metadataHash, RulesSHA256: rulesHash})
+		}
+		return false, nil
+	}
 
-		case "{: #customer-private-network-space}":
-			ipType = "customer-private-network-space"
+	if fetched.NotModified {
+		// Only the metadata or the rules changed, the server has no body for a 304.
+		fetched, err = fetchSource(options.Source, util.FetchState{})
+		if err != nil {
+			return false, fmt.Errorf("error getting ips.md from %s: %w", options.Source, err)
+		}
+	}
 
-		case "{: #service-network}":
-			ipType = "service-network"
+	markdown := fetched.Body
+	newState := sourceState{Source: options.Source.String(), Fetch: fetched.State, MetadataSHA256: metadataHash, RulesSHA256: rulesHash}
 
-		case "{: #service-by-data-center}":
-			ipType = "service-by-data-center"
+	lastRan := time.Now()
 
-		case "{: #ssl-vpn-data-centers}":
-			ipType = "ssl-vpn-data-centers"
+	plan, err := buildPlan(markdown, metadata, rules, options, lastRan)
+	for _, warning := range plan.Warnings {
+		logger.SystemLogger.Warn("ips.md section warning",
+			zap.String("section", warning.Section),
+			zap.Int("line", warning.Line),
+			zap.String("message", warning.Message),
+		)
+	}
+	if err != nil {
+		return false, err
+	}
 
-		case "{: #ssl-vpn-pops}":
-			ipType = "ssl-vpn-pops"
+	diff := plan.Diff
+	logger.SystemLogger.Info("changes found since last run.",
+		zap.Int("data_centers_added", len(diff.DataCentersAdded)),
+		zap.Int("data_centers_removed", len(diff.DataCentersRemoved)),
+		zap.Int("cidr_changes", len(diff.CidrChanges)),
+		zap.Int("metadata_changes", len(diff.MetadataChanges)),
+		zap.Int("flow_changes", len(diff.FlowChanges)),
+	)
 
-		case "{: #legacy-networks}":
-			ipType = "legacy-networks"
+	if len(plan.MissingMetadata) > 0 {
+		if err := util.WriteFileAtomic(MetadataStubPath, plan.MetadataStub, 0644); err != nil {
+			return false, fmt.Errorf("error writing %s: %w", MetadataStubPath, err)
+		}
+		logger.SystemLogger.Warn("data centers are missing from the metadata, fill in the stub and merge it.",
+			zap.Strings("data_centers", plan.MissingMetadata),
+			zap.String("metadata", MetadataPath),
+			zap.String("stub", MetadataStubPath),
+			zap.Bool("allowed", options.AllowMissingMetadata),
+		)
+	}
 
-		case "{: #red-hat-enterprise-linux-server}":
-			ipType = "rhe-linux-server"
+	for _, listing := range plan.ClosedListed {
+		logger.SystemLogger.Warn("a closed data center is still listed in ips.md.",
+			zap.String("data_center", listing.DataCenter),
+			zap.Strings("networks", listing.Networks),
+		)
+	}
 
-		case "{: #windows-vsi-server}":
-			ipType = "win-vsi-server"
+	if !plan.Changed() {
+		logger.SystemLogger.Info("the data set is unchanged, nothing is published.")
+		if options.SaveSnapshot {
+			// The snapshot still pins offline runs to the revision just fetched.
+			if err := saveSnapshot(options.Source, markdown); err != nil {
+				return false, err
+			}
+		}
+		return false, saveSourceState(newState)
+	}
 
-		case "{: tab-title=\"eVault\"}":
-			nextService = "file_block"
+	for _, failure := range plan.Validation.Failures {
+		logger.ErrorLogger.Error("data set validation failure",
+			zap.String("check", failure.Check),
+			zap.String("data_center", failure.DataCenter),
+			zap.String("service", failure.Service),
+			zap.String("message", failure.Message),
+		)
+	}
+	if err := plan.Validation.Err(); err != nil {
+		return false, fmt.Errorf("the data set is not published: %w", err)
+	}
 
-		case "{: tab-title=\"File & Block\"}":
-			nextService = "advmon"
+	r, err := newRelease(archive.NewVersionID(lastRan), plan.ipRanges, diff)
+	if err != nil {
+		return false, err
+	}
 
-		case "{: tab-title=\"AdvMon (Nimsoft)\"}":
-			nextService = "icos"
+	// Upload before writing ../data, so a failed upload is retried by the next
+	// run instead of being seen as unchanged.
+	if options.Store != nil {
+		if err := publishRelease(options.Store, r); err != nil {
+			return false, fmt.Errorf("error publishing the data set: %w", err)
 		}
+	}
 
-		if ipType != "" {
-			if strings.HasPrefix(line, "|") {
-				if ipType == "front-end-network" {
-					parseFEN(line)
-				}
-				if ipType == "load-balancer-ips" {
-					parseLBIPS(line)
-				}
-				if ipType == "customer-private-network-space" {
-					parseCPNS(line)
-				}
-				if ipType == "service-network" {
-					parseSN(line)
-				}
-				if ipType == "service-by-data-center" {
-					parseSDC(line, nextService)
-				}
-				if ipType == "ssl-vpn-data-centers" {
-					parseSSLVPN(line)
-				}
-				if ipType == "ssl-vpn-pops" {
-					parseSSLVPNPOPS(line)
-				}
-				if ipType == "rhe-linux-server" {
-					parseRHELS(line)
-				}
-			}
-		}
+	if err := saveIPRanges(markdown, r, diff, options.Source.String(), options.Retention); err != nil {
+		return false, fmt.Errorf("error saving the data set: %w", err)
 	}
 
-	createDataCenters()
+	if options.SaveSnapshot {
+		if err := saveSnapshot(options.Source, markdown); err != nil {
+			return true, err
+		}
+	}
 
-	e := exec.Command("cp", "ips.json", "../data/datacenters.json").Run()
-	if e != nil {
-		logger.SystemLogger.Debug("File not found", zap.String("file", "ips.json"))
+	for _, conflict := range plan.NewConflicts {
+		logger.SystemLogger.Warn("new conflict with a watched CIDR",
+			zap.String("owner", conflict.Owner),
+			zap.String("watched_cidr", conflict.Watched),
+			zap.String("data_center", conflict.DataCenter),
+			zap.String("service", conflict.Service),
+			zap.String("cidr", conflict.Cidr),
+		)
 	}
 
-	removeTempFiles()
+	notify(options.Notifiers, ReleaseEvent{
+		Event:        EventPublished,
+		Version:      r.stamp,
+		LastUpdated:  plan.ipRanges.LastUpdated,
+		Diff:         diff,
+		NewConflicts: plan.NewConflicts,
+	})
+
+	return true, saveSourceState(newState)
+}
+
+func saveSourceState(state sourceState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(StatePath, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", StatePath, err)
+	}
+	return nil
 }
@@ -0,0 +1,211 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"dprosper/calculator/internal/subnetcalc"
+)
+
+// Validation checks, as reported in ValidationIssue.Check.
+const (
+	CheckInvalidCidr       = "invalid_cidr"
+	CheckHostBits          = "host_bits"
+	CheckDuplicate         = "duplicate"
+	CheckNoPrivateNetworks = "no_private_networks"
+	CheckMissingMetadata   = "missing_metadata"
+	CheckCountDrop         = "count_drop"
+	CheckDependencyRule    = "dependency_rule"
+)
+
+// ValidationOptions tunes ValidateIPRanges. MaxCountDrop is the fraction, e.g.
+// 0.1 for 10%, by which the number of data centers or of CIDR blocks of a service
+// may drop from the previous version. NoPrivateNetworks lists the data centers
+// that are published without private networks. AllowMissingMetadata publishes
+// data centers without a city or geo region.
+type ValidationOptions struct {
+	MaxCountDrop         float64
+	NoPrivateNetworks    []string
+	AllowMissingMetadata bool
+}
+
+// DefaultValidationOptions are used by the backend job. The data centers
+// published without private networks come from the job configuration.
+var DefaultValidationOptions = ValidationOptions{
+	MaxCountDrop: 0.1,
+}
+
+// ValidationIssue is a problem found in the data set.
+type ValidationIssue struct {
+	Check      string `json:"check"`
+	DataCenter string `json:"data_center,omitempty"`
+	Service    string `json:"service,omitempty"`
+	Message    string `json:"message"`
+}
+
+func (i ValidationIssue) String() string {
+	location := i.DataCenter
+	if i.Service != "" {
+		location = strings.TrimSpace(location + " " + i.Service)
+	}
+	if location != "" {
+		return fmt.Sprintf("%s: %s: %s", i.Check, location, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.Check, i.Message)
+}
+
+// ValidationReport lists the problems that stop the data set from being published.
+type ValidationReport struct {
+	Failures []ValidationIssue `json:"failures"`
+}
+
+func (r *ValidationReport) fail(check string, dataCenter string, service string, format string, args ...interface{}) {
+	r.Failures = append(r.Failures, ValidationIssue{Check: check, DataCenter: dataCenter, Service: service, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns an error listing the failures, or nil when there are none.
+func (r ValidationReport) Err() error {
+	if len(r.Failures) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(r.Failures))
+	for _, failure := range r.Failures {
+		messages = append(messages, failure.String())
+	}
+	return fmt.Errorf("data set failed validation: %s", strings.Join(messages, "; "))
+}
+
+// ValidateIPRanges checks the data set before it is published. previous is the
+// published version the counts are compared with, it is skipped when it has no
+// data centers.
+func ValidateIPRanges(current ICIPRanges, previous ICIPRanges, options ValidationOptions) ValidationReport {
+	var report ValidationReport
+
+	seenDataCenters := map[string]bool{}
+	for _, dataCenter := range current.DataCenters {
+		name := strings.ToLower(dataCenter.Name)
+		if seenDataCenters[name] {
+			report.fail(CheckDuplicate, name, "", "data center is listed more than once")
+			continue
+		}
+		seenDataCenters[name] = true
+
+		validateDataCenter(&report, name, dataCenter, !contains(options.NoPrivateNetworks, name), !options.AllowMissingMetadata)
+	}
+
+	if len(previous.DataCenters) > 0 {
+		validateCounts(&report, current, previous, options.MaxCountDrop)
+	}
+
+	return report
+}
+
+func validateDataCenter(report *ValidationReport, name string, dataCenter subnetcalc.DataCenter, needsPrivateNetworks bool, needsMetadata bool) {
+	if needsMetadata && dataCenter.City == "" {
+		report.fail(CheckMissingMetadata, name, "", "city is empty, add the data center to %s", MetadataPath)
+	}
+	if needsMetadata && dataCenter.GeoRegion == "" {
+		report.fail(CheckMissingMetadata, name, "", "geo region is empty, add the data center to %s", MetadataPath)
+	}
+
+	if needsPrivateNetworks && len(dataCenter.PrivateNetworks) == 0 {
+		report.fail(CheckNoPrivateNetworks, name, "", "data center has no private networks")
+	}
+
+	seen := map[string]bool{}
+	for _, block := range dataCenter.ServiceBlocks() {
+		service := block.Service
+		if block.Key != "" {
+			service = fmt.Sprintf("%s (%s)", block.Service, block.Key)
+		}
+
+		for _, cidr := range block.CidrBlocks {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				report.fail(CheckInvalidCidr, name, service, "%q is not a valid CIDR block", cidr)
+				continue
+			}
+			if prefix.Masked() != prefix {
+				report.fail(CheckHostBits, name, service, "%s has host bits set, expected %s", cidr, prefix.Masked())
+			}
+
+			entry := service + "|" + prefix.Masked().String()
+			if seen[entry] {
+				report.fail(CheckDuplicate, name, service, "%s is listed more than once", cidr)
+			}
+			seen[entry] = true
+		}
+	}
+}
+
+// validateCounts fails when the number of data centers, or of CIDR blocks of a
+// service across all data centers, dropped by more than maxDrop.
+func validateCounts(report *ValidationReport, current ICIPRanges, previous ICIPRanges, maxDrop float64) {
+	checkDrop := func(service string, before int, after int) {
+		if before > 0 && float64(after) < float64(before)*(1-maxDrop) {
+			report.fail(CheckCountDrop, "", service, "count dropped from %d to %d, more than %.0f%%", before, after, maxDrop*100)
+		}
+	}
+
+	checkDrop("data centers", len(previous.DataCenters), len(current.DataCenters))
+
+	before := countCidrsByService(previous)
+	after := countCidrsByService(current)
+
+	services := make([]string, 0, len(before))
+	for service := range before {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		checkDrop(service, before[service], after[service])
+	}
+}
+
+// countCidrsByService counts the distinct CIDR blocks of each service and data
+// center, so duplicates removed from the previous version are not a drop.
+func countCidrsByService(ipRanges ICIPRanges) map[string]int {
+	counts := map[string]int{}
+	seen := map[string]bool{}
+	for _, dataCenter := range ipRanges.DataCenters {
+		for _, block := range dataCenter.ServiceBlocks() {
+			for _, cidr := range block.CidrBlocks {
+				entry := strings.Join([]string{dataCenter.Name, block.Service, block.Key, cidr}, "|")
+				if !seen[entry] {
+					seen[entry] = true
+					counts[block.Service]++
+				}
+			}
+		}
+	}
+	return counts
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
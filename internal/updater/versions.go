@@ -0,0 +1,191 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"dprosper/calculator/internal/archive"
+	"dprosper/calculator/internal/util"
+)
+
+// Paths of the published data set and of the archive of published versions,
+// relative to the backend-job directory.
+const (
+	DatasetPath = "../data/datacenters.json"
+	ArchiveDir  = "../data/versions"
+)
+
+// PublishedVersion is an archived version. Current is set on the version
+// DatasetPath holds.
+type PublishedVersion struct {
+	archive.Version
+	Current bool `json:"current"`
+}
+
+// archiveRelease stores r with its source markdown in the archive. The data set
+// it replaces is archived too when it is not a version yet, e.g. on the first run.
+func archiveRelease(a *archive.Archive, r release, source string, markdown []byte) error {
+	if err := retainCurrent(a); err != nil {
+		return fmt.Errorf("error keeping the previous data set: %w", err)
+	}
+
+	_, err := a.Add(r.stamp, source, r.ipRanges.LastUpdated, map[string][]byte{
+		archive.DatasetFile:   r.dataset,
+		archive.SourceFile:    markdown,
+		archive.DiffFile:      r.diff,
+		archive.ChangelogFile: r.changelog,
+	})
+	return err
+}
+
+func retainCurrent(a *archive.Archive) error {
+	current, err := os.ReadFile(DatasetPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, found, err := a.Find(util.SHA256(current)); err != nil || found {
+		return err
+	}
+
+	manifest, err := a.Manifest()
+	if err != nil {
+		return err
+	}
+
+	previous, _ := LoadIPRangesData(current)
+	_, err = a.Add(retainedVersionID(manifest, previous.LastUpdated), "", previous.LastUpdated, map[string][]byte{
+		archive.DatasetFile: current,
+	})
+	return err
+}
+
+// retainedVersionID names a data set that is archived after it was published,
+// from the start of its last_updated day so it sorts before the versions the
+// job publishes later that day. It is moved on by a second while it is taken.
+func retainedVersionID(manifest archive.Manifest, lastUpdated string) string {
+	stamp, _ := time.Parse("01/02/2006", lastUpdated)
+
+	taken := map[string]bool{}
+	for _, version := range manifest.Versions {
+		taken[version.ID] = true
+	}
+	for taken[archive.NewVersionID(stamp)] {
+		stamp = stamp.Add(time.Second)
+	}
+	return archive.NewVersionID(stamp)
+}
+
+// currentVersion returns the id of the archived version DatasetPath holds.
+func currentVersion(a *archive.Archive) (string, error) {
+	current, err := os.ReadFile(DatasetPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	version, _, err := a.Find(util.SHA256(current))
+	return version.ID, err
+}
+
+// previousVersion returns the id of the version archived before id, the one a
+// rollback without a version restores when id is published.
+func previousVersion(a *archive.Archive, id string) (string, error) {
+	manifest, err := a.Manifest()
+	if err != nil {
+		return "", err
+	}
+
+	for i, version := range manifest.Versions {
+		if version.ID == id && i > 0 {
+			return manifest.Versions[i-1].ID, nil
+		}
+	}
+	return "", nil
+}
+
+// ListVersions returns the archived versions, oldest first.
+func ListVersions() ([]PublishedVersion, error) {
+	a := archive.Open(ArchiveDir)
+
+	manifest, err := a.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := currentVersion(a)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]PublishedVersion, 0, len(manifest.Versions))
+	for _, version := range manifest.Versions {
+		versions = append(versions, PublishedVersion{Version: version, Current: version.ID == current})
+	}
+	return versions, nil
+}
+
+// Rollback atomically restores the archived version id as the published data
+// set. An empty id restores the version published before the current one.
+func Rollback(id string) (PublishedVersion, error) {
+	versions, err := ListVersions()
+	if err != nil {
+		return PublishedVersion{}, err
+	}
+	if len(versions) == 0 {
+		return PublishedVersion{}, fmt.Errorf("no versions found in %s", ArchiveDir)
+	}
+
+	if id == "" {
+		for i, version := range versions {
+			if version.Current && i > 0 {
+				id = versions[i-1].ID
+			}
+		}
+		if id == "" {
+			return PublishedVersion{}, fmt.Errorf("no version before the current data set, use a version id")
+		}
+	}
+
+	a := archive.Open(ArchiveDir)
+	version, err := a.Get(id)
+	if err != nil {
+		return PublishedVersion{}, err
+	}
+
+	data, err := a.ReadFile(version.ID, archive.DatasetFile)
+	if err != nil {
+		return PublishedVersion{}, err
+	}
+	if _, err := LoadIPRangesData(data); err != nil {
+		return PublishedVersion{}, fmt.Errorf("version %s is not a valid data set: %w", version.ID, err)
+	}
+
+	if err := util.WriteFileAtomic(DatasetPath, data, 0644); err != nil {
+		return PublishedVersion{}, err
+	}
+
+	return PublishedVersion{Version: version, Current: true}, nil
+}
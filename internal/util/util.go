@@ -1,30 +1,60 @@
 package util
 
 import (
+	"crypto/sha256"
 	"dprosper/calculator/internal/logger"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"time"
 )
 
-// GetRemoteJSON function
-func GetRemoteJSON(requestURL string, saveFile string) {
-	e := os.Remove(saveFile)
-	if e != nil {
-		fmt.Println(saveFile + " file not found")
-	}
+// FetchState holds the validators of a previous download, so the next one can
+// be skipped when the content did not change.
+type FetchState struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+}
+
+// FetchResult is the outcome of ConditionalGet. Body is empty when NotModified
+// is set by a 304 response. Unchanged is set when the server answered 304 or the
+// body has the hash recorded in the previous state.
+type FetchResult struct {
+	Body        []byte
+	State       FetchState
+	NotModified bool
+	Unchanged   bool
+}
+
+// SHA256 returns the hex encoded SHA-256 of data.
+func SHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
 
+// ConditionalGet downloads requestURL with If-None-Match and If-Modified-Since
+// set from previous.
+func ConditionalGet(requestURL string, previous FetchState) (FetchResult, error) {
 	url1, err := url.ParseRequestURI(requestURL)
 	if err != nil || url1.Scheme == "" {
-		logger.ErrorLogger.Fatal(fmt.Sprintf("Error encountered while parsing the request url: %v", err))
+		return FetchResult{}, fmt.Errorf("invalid request url %q: %v", requestURL, err)
 	}
 
 	httpRequest, _ := http.NewRequest("GET", requestURL, nil)
 	httpRequest.Header.Set("User-Agent", "cidr-calculator (dimitri.prosper@gmail.com)")
 	httpRequest.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if previous.ETag != "" {
+		httpRequest.Header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		httpRequest.Header.Set("If-Modified-Since", previous.LastModified)
+	}
 
 	httpClient := &http.Client{
 		Timeout: time.Duration(30 * time.Second),
@@ -32,17 +62,101 @@ func GetRemoteJSON(requestURL string, saveFile string) {
 
 	httpResponse, err := httpClient.Do(httpRequest)
 	if err != nil {
-		logger.ErrorLogger.Fatal(fmt.Sprintf("Error encountered while performing http request: %v", err))
+		return FetchResult{}, fmt.Errorf("error encountered while performing http request: %w", err)
 	}
 	defer httpResponse.Body.Close()
 
 	logger.SystemLogger.Info(fmt.Sprintf("response: %s", httpResponse.Status))
 
-	if httpResponse.StatusCode >= 200 && httpResponse.StatusCode < 300 {
-		body, _ := io.ReadAll(httpResponse.Body)
-		err = os.WriteFile(saveFile, body, 0644)
-		if err != nil {
-			logger.ErrorLogger.Fatal(fmt.Sprintf("Error encountered while writting "+saveFile+" to local file system: %v", err))
-		}
+	if httpResponse.StatusCode == http.StatusNotModified {
+		return FetchResult{State: previous, NotModified: true, Unchanged: true}, nil
+	}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		return FetchResult{}, fmt.Errorf("request to %s failed: %s", requestURL, httpResponse.Status)
+	}
+
+	body, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return FetchResult{}, err
+	}
+
+	state := FetchState{
+		ETag:         httpResponse.Header.Get("ETag"),
+		LastModified: httpResponse.Header.Get("Last-Modified"),
+		SHA256:       SHA256(body),
+	}
+
+	return FetchResult{Body: body, State: state, Unchanged: previous.SHA256 != "" && state.SHA256 == previous.SHA256}, nil
+}
+
+// WriteFileAtomic writes data to a temporary file next to path, syncs it and
+// renames it over path, so readers see either the old or the new content.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename survives a crash.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// GetRemoteJSON function. The validators of the download are kept in
+// saveFile.state and the file is not rewritten when it did not change.
+func GetRemoteJSON(requestURL string, saveFile string) {
+	var previous FetchState
+	stateFile := saveFile + ".state"
+	if data, err := os.ReadFile(stateFile); err == nil {
+		json.Unmarshal(data, &previous)
+	}
+	if _, err := os.Stat(saveFile); err != nil {
+		previous = FetchState{}
+	}
+
+	result, err := ConditionalGet(requestURL, previous)
+	if err != nil {
+		logger.ErrorLogger.Fatal(fmt.Sprintf("Error encountered while performing http request: %v", err))
+	}
+
+	if result.Unchanged {
+		logger.SystemLogger.Info(saveFile + " is unchanged")
+		return
+	}
+
+	err = WriteFileAtomic(saveFile, result.Body, 0644)
+	if err != nil {
+		logger.ErrorLogger.Fatal(fmt.Sprintf("Error encountered while writting "+saveFile+" to local file system: %v", err))
+	}
+
+	state, _ := json.Marshal(result.State)
+	err = WriteFileAtomic(stateFile, state, 0644)
+	if err != nil {
+		logger.ErrorLogger.Fatal(fmt.Sprintf("Error encountered while writting "+stateFile+" to local file system: %v", err))
 	}
 }
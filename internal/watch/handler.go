@@ -0,0 +1,72 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watch
+
+import (
+	"net/http"
+	"sort"
+
+	"dprosper/calculator/internal/logger"
+	"dprosper/calculator/internal/subnetcalc"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// OwnerConflicts are the conflicts of an owner, as served by ConflictsHandler.
+type OwnerConflicts struct {
+	Owner     string     `json:"owner"`
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+// ConflictsHandler serves the conflicts between the watched CIDRs in
+// registryPath and the data set in datasetPath, grouped by owner. Both files are
+// read on each request so registry changes apply right away. The owner query
+// parameter, repeatable, selects owners.
+func ConflictsHandler(registryPath string, datasetPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registry, err := LoadRegistry(registryPath)
+		if err != nil {
+			logger.ErrorLogger.Error("error reading watched CIDRs", zap.String("path", registryPath), zap.String("error: ", err.Error()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Watched CIDRs are not available."})
+			return
+		}
+
+		dataset, err := subnetcalc.LoadConfig(datasetPath)
+		if err != nil {
+			logger.ErrorLogger.Error("error reading data set", zap.String("path", datasetPath), zap.String("error: ", err.Error()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Data set is not available."})
+			return
+		}
+
+		conflicts := FilterOwners(FindConflicts(registry, dataset.DataCenters), c.QueryArray("owner"))
+		byOwner := ByOwner(conflicts)
+
+		owners := make([]OwnerConflicts, 0, len(byOwner))
+		for owner, ownerConflicts := range byOwner {
+			owners = append(owners, OwnerConflicts{Owner: owner, Conflicts: ownerConflicts})
+		}
+		sort.Slice(owners, func(i, j int) bool {
+			return owners[i].Owner < owners[j].Owner
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"last_updated": dataset.LastUpdated,
+			"owners":       owners,
+		})
+	}
+}
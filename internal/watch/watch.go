@@ -0,0 +1,209 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"dprosper/calculator/internal/subnetcalc"
+)
+
+// Watched is a CIDR of our own networks, such as a deployed VPC or on-premises
+// subnet, that must not overlap the IBM Cloud ranges. DataCenters limits the
+// check to the data centers the network is routed to, all are checked when it
+// is empty.
+type Watched struct {
+	CIDR        string   `json:"cidr"`
+	Owner       string   `json:"owner"`
+	Description string   `json:"description,omitempty"`
+	DataCenters []string `json:"data_centers,omitempty"`
+}
+
+// Registry is the list of watched CIDRs, as stored in its JSON file.
+type Registry struct {
+	Watched []Watched `json:"watched"`
+}
+
+// LoadRegistry reads and validates the registry in path.
+func LoadRegistry(path string) (Registry, error) {
+	var registry Registry
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return registry, err
+	}
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return registry, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if err := registry.Validate(); err != nil {
+		return registry, fmt.Errorf("invalid watched CIDRs in %s: %w", path, err)
+	}
+	return registry, nil
+}
+
+// Validate checks each CIDR parses, has an owner and is listed once per owner.
+func (r Registry) Validate() error {
+	seen := map[string]bool{}
+	for i, watched := range r.Watched {
+		prefix, err := netip.ParsePrefix(watched.CIDR)
+		if err != nil {
+			return fmt.Errorf("entry %d: invalid CIDR %q", i, watched.CIDR)
+		}
+		if prefix.Masked() != prefix {
+			return fmt.Errorf("entry %d: %s has host bits set, expected %s", i, watched.CIDR, prefix.Masked())
+		}
+		if strings.TrimSpace(watched.Owner) == "" {
+			return fmt.Errorf("entry %d: %s has no owner", i, watched.CIDR)
+		}
+
+		key := watched.Owner + " " + watched.CIDR
+		if seen[key] {
+			return fmt.Errorf("entry %d: %s is listed more than once for %s", i, watched.CIDR, watched.Owner)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Conflict is a watched CIDR that overlaps a CIDR block of a data center.
+type Conflict struct {
+	Owner       string `json:"owner"`
+	Watched     string `json:"watched_cidr"`
+	Description string `json:"description,omitempty"`
+	DataCenter  string `json:"data_center"`
+	Service     string `json:"service"`
+	Pod         string `json:"pod,omitempty"`
+	Cidr        string `json:"cidr"`
+}
+
+func (c Conflict) String() string {
+	service := c.Service
+	if c.Pod != "" {
+		service += " (" + c.Pod + ")"
+	}
+	return fmt.Sprintf("%s: %s overlaps %s %s %s", c.Owner, c.Watched, c.DataCenter, service, c.Cidr)
+}
+
+func (c Conflict) key() string {
+	return strings.Join([]string{c.Owner, c.Watched, c.DataCenter, c.Service, c.Pod, c.Cidr}, " ")
+}
+
+// FindConflicts compares every watched CIDR with every CIDR block of
+// dataCenters with subnetcalc.CompareCidrNetworksV2. Blocks that do not parse
+// are skipped, the updater validation reports them.
+func FindConflicts(registry Registry, dataCenters []subnetcalc.DataCenter) []Conflict {
+	conflicts := []Conflict{}
+
+	for _, dataCenter := range dataCenters {
+		name := strings.ToLower(dataCenter.Name)
+		for _, block := range dataCenter.ServiceBlocks() {
+			for _, cidr := range block.CidrBlocks {
+				if _, err := netip.ParsePrefix(cidr); err != nil {
+					continue
+				}
+				for _, watched := range registry.Watched {
+					if !watchedIn(watched, name) || !subnetcalc.CompareCidrNetworksV2(watched.CIDR, cidr) {
+						continue
+					}
+					conflicts = append(conflicts, Conflict{
+						Owner:       watched.Owner,
+						Watched:     watched.CIDR,
+						Description: watched.Description,
+						DataCenter:  name,
+						Service:     block.Service,
+						Pod:         block.Key,
+						Cidr:        cidr,
+					})
+				}
+			}
+		}
+	}
+
+	sortConflicts(conflicts)
+	return conflicts
+}
+
+func watchedIn(watched Watched, dataCenter string) bool {
+	if len(watched.DataCenters) == 0 {
+		return true
+	}
+	for _, name := range watched.DataCenters {
+		if strings.EqualFold(name, dataCenter) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewConflicts returns the conflicts of current that are not in previous, the
+// ones a data set update introduced.
+func NewConflicts(previous []Conflict, current []Conflict) []Conflict {
+	known := make(map[string]bool, len(previous))
+	for _, conflict := range previous {
+		known[conflict.key()] = true
+	}
+
+	introduced := []Conflict{}
+	for _, conflict := range current {
+		if !known[conflict.key()] {
+			introduced = append(introduced, conflict)
+		}
+	}
+	return introduced
+}
+
+// ByOwner groups conflicts by owner.
+func ByOwner(conflicts []Conflict) map[string][]Conflict {
+	owners := map[string][]Conflict{}
+	for _, conflict := range conflicts {
+		owners[conflict.Owner] = append(owners[conflict.Owner], conflict)
+	}
+	return owners
+}
+
+// FilterOwners returns the conflicts of owners, all conflicts when owners is
+// empty. Owners are compared case-insensitively.
+func FilterOwners(conflicts []Conflict, owners []string) []Conflict {
+	if len(owners) == 0 {
+		return conflicts
+	}
+
+	filtered := []Conflict{}
+	for _, conflict := range conflicts {
+		for _, owner := range owners {
+			if strings.EqualFold(owner, conflict.Owner) {
+				filtered = append(filtered, conflict)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func sortConflicts(conflicts []Conflict) {
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if conflicts[i].Owner != conflicts[j].Owner {
+			return conflicts[i].Owner < conflicts[j].Owner
+		}
+		return conflicts[i].key() < conflicts[j].key()
+	})
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"dprosper/calculator/internal/updater"
+)
+
+// jsonPayload is the body of FormatJSON.
+type jsonPayload struct {
+	updater.ReleaseEvent
+	AffectedDataCenters []string `json:"affected_data_centers"`
+	AffectedServices    []string `json:"affected_services"`
+}
+
+// chatPayload is the body of FormatChat.
+type chatPayload struct {
+	Text string `json:"text"`
+}
+
+func payload(format string, event updater.ReleaseEvent) ([]byte, error) {
+	switch format {
+	case FormatChat:
+		return json.Marshal(chatPayload{Text: chatText(event)})
+	default:
+		return json.Marshal(jsonPayload{
+			ReleaseEvent:        event,
+			AffectedDataCenters: event.Diff.AffectedDataCenters(),
+			AffectedServices:    event.Diff.AffectedServices(),
+		})
+	}
+}
+
+// chatText summarizes the diff in plain text, one line per change.
+func chatText(event updater.ReleaseEvent) string {
+	diff := event.Diff
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "IBM Cloud IP ranges changed (version %s, %s)\n", event.Version, event.LastUpdated)
+
+	if len(diff.DataCentersAdded) > 0 {
+		fmt.Fprintf(&b, "Added data centers: %s\n", strings.Join(diff.DataCentersAdded, ", "))
+	}
+	if len(diff.DataCentersRemoved) > 0 {
+		fmt.Fprintf(&b, "Removed data centers: %s\n", strings.Join(diff.DataCentersRemoved, ", "))
+	}
+	for _, change := range diff.CidrChanges {
+		service := change.Service
+		if change.Pod != "" {
+			service += " (" + change.Pod + ")"
+		}
+		fmt.Fprintf(&b, "• %s %s:", change.DataCenter, service)
+		for _, cidr := range change.Added {
+			fmt.Fprintf(&b, " +%s", cidr)
+		}
+		for _, cidr := range change.Removed {
+			fmt.Fprintf(&b, " -%s", cidr)
+		}
+		b.WriteString("\n")
+	}
+	for _, change := range diff.MetadataChanges {
+		fmt.Fprintf(&b, "• %s %s: %q -> %q\n", change.DataCenter, change.Field, change.From, change.To)
+	}
+	for _, change := range diff.FlowChanges {
+		fmt.Fprintf(&b, "• %s %s flows:", change.DataCenter, change.Service)
+		for _, flow := range change.Added {
+			fmt.Fprintf(&b, " +%s", flow)
+		}
+		for _, flow := range change.Removed {
+			fmt.Fprintf(&b, " -%s", flow)
+		}
+		b.WriteString("\n")
+	}
+	if len(event.NewConflicts) > 0 {
+		fmt.Fprintf(&b, "New conflicts with watched CIDRs:\n")
+		for _, conflict := range event.NewConflicts {
+			fmt.Fprintf(&b, "• %s\n", conflict)
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
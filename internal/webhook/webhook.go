@@ -0,0 +1,309 @@
+/*
+Copyright © 2022 Dimitri Prosper <dimitri.prosper@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dprosper/calculator/internal/logger"
+	"dprosper/calculator/internal/updater"
+	"dprosper/calculator/internal/watch"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Payload formats of a subscriber.
+const (
+	// FormatJSON posts the event with the filtered diff.
+	FormatJSON = "json"
+	// FormatChat posts {"text": ...}, as accepted by Slack, Mattermost and
+	// Google Chat incoming webhooks.
+	FormatChat = "chat"
+)
+
+// Request headers. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the subscriber secret, prefixed with "sha256=".
+const (
+	HeaderEvent     = "X-Calculator-Event"
+	HeaderDelivery  = "X-Calculator-Delivery"
+	HeaderTimestamp = "X-Calculator-Timestamp"
+	HeaderSignature = "X-Calculator-Signature"
+)
+
+// DefaultMaxAttempts is used when a subscriber does not set max_attempts.
+const DefaultMaxAttempts = 3
+
+// Subscriber receives the changes of each published version. DataCenters and
+// Services narrow down the changes it receives, see updater.DatasetDiff.Filter.
+// DataCenters and Owners narrow down the new conflicts with watched CIDRs.
+type Subscriber struct {
+	Name        string   `mapstructure:"name" json:"name"`
+	URL         string   `mapstructure:"url" json:"url"`
+	Format      string   `mapstructure:"format" json:"format"`
+	Secret      string   `mapstructure:"secret" json:"-"`
+	DataCenters []string `mapstructure:"data_centers" json:"data_centers,omitempty"`
+	Services    []string `mapstructure:"services" json:"services,omitempty"`
+	Owners      []string `mapstructure:"owners" json:"owners,omitempty"`
+	MaxAttempts int      `mapstructure:"max_attempts" json:"max_attempts,omitempty"`
+}
+
+// Delivery is a line of the delivery log, one per attempt.
+type Delivery struct {
+	Time       time.Time `json:"time"`
+	ID         string    `json:"id"`
+	Subscriber string    `json:"subscriber"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	Version    string    `json:"version"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+	// Skipped is set when the filters of the subscriber leave no changes and no
+	// conflicts.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Dispatcher posts events to subscribers. It implements updater.Notifier.
+type Dispatcher struct {
+	Subscribers []Subscriber
+	// LogPath is the delivery log, a JSON object per line. Nothing is logged
+	// when it is empty.
+	LogPath string
+
+	httpClient *http.Client
+	backoff    time.Duration
+	now        func() time.Time
+}
+
+// NewDispatcher validates subscribers and returns a dispatcher for them.
+func NewDispatcher(subscribers []Subscriber, logPath string) (*Dispatcher, error) {
+	subscribers = append([]Subscriber{}, subscribers...)
+	for i, subscriber := range subscribers {
+		if subscriber.Name == "" {
+			subscriber.Name = fmt.Sprintf("webhook-%d", i+1)
+		}
+		parsed, err := url.ParseRequestURI(subscriber.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("webhook %s: invalid url %q", subscriber.Name, subscriber.URL)
+		}
+		switch subscriber.Format {
+		case "":
+			subscriber.Format = FormatJSON
+		case FormatJSON, FormatChat:
+		default:
+			return nil, fmt.Errorf("webhook %s: unknown format %q, expected %s or %s", subscriber.Name, subscriber.Format, FormatJSON, FormatChat)
+		}
+		if subscriber.MaxAttempts <= 0 {
+			subscriber.MaxAttempts = DefaultMaxAttempts
+		}
+		subscribers[i] = subscriber
+	}
+
+	return &Dispatcher{
+		Subscribers: subscribers,
+		LogPath:     logPath,
+		httpClient:  &http.Client{Timeout: time.Duration(30 * time.Second)},
+		backoff:     2 * time.Second,
+		now:         time.Now,
+	}, nil
+}
+
+// Notify delivers event to each subscriber whose filters match some of its
+// changes. It returns an error listing the subscribers that could not be
+// reached after their retries.
+func (d *Dispatcher) Notify(event updater.ReleaseEvent) error {
+	var failed []string
+	for _, subscriber := range d.Subscribers {
+		if err := d.deliver(subscriber, event); err != nil {
+			logger.ErrorLogger.Error("webhook delivery failed",
+				zap.String("subscriber", subscriber.Name),
+				zap.String("error: ", err.Error()),
+			)
+			failed = append(failed, subscriber.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("webhook delivery failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (d *Dispatcher) deliver(subscriber Subscriber, event updater.ReleaseEvent) error {
+	event.Diff = event.Diff.Filter(subscriber.DataCenters, subscriber.Services)
+	event.NewConflicts = filterConflicts(event.NewConflicts, subscriber)
+	delivery := Delivery{
+		ID:         uuid.New().String(),
+		Subscriber: subscriber.Name,
+		URL:        subscriber.URL,
+		Event:      event.Event,
+		Version:    event.Version,
+	}
+
+	if event.Diff.Empty() && len(event.NewConflicts) == 0 {
+		delivery.Time = d.now().UTC()
+		delivery.Skipped = true
+		d.log(delivery)
+		return nil
+	}
+
+	body, err := payload(subscriber.Format, event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; attempt <= subscriber.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(d.backoff * time.Duration(1<<(attempt-2)))
+		}
+
+		delivery.Attempt = attempt
+		delivery.Time = d.now().UTC()
+		statusCode, err := d.post(subscriber, delivery, body)
+		delivery.DurationMs = d.now().Sub(delivery.Time).Milliseconds()
+		delivery.StatusCode = statusCode
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		d.log(delivery)
+
+		if err == nil {
+			logger.SystemLogger.Info("webhook delivered",
+				zap.String("subscriber", subscriber.Name),
+				zap.String("delivery", delivery.ID),
+				zap.Int("attempt", attempt),
+			)
+			return nil
+		}
+		if !retryable(statusCode) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("no success after %d attempts: %s", subscriber.MaxAttempts, delivery.Error)
+}
+
+func filterConflicts(conflicts []watch.Conflict, subscriber Subscriber) []watch.Conflict {
+	filtered := []watch.Conflict{}
+	for _, conflict := range watch.FilterOwners(conflicts, subscriber.Owners) {
+		if len(subscriber.DataCenters) == 0 || containsFold(subscriber.DataCenters, conflict.DataCenter) {
+			filtered = append(filtered, conflict)
+		}
+	}
+	return filtered
+}
+
+func containsFold(values []string, value string) bool {
+	for _, item := range values {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// post sends body to the subscriber. It returns the status code of the response,
+// 0 when there was none.
+func (d *Dispatcher) post(subscriber Subscriber, delivery Delivery, body []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, subscriber.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(delivery.Time.Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "cidr-calculator-webhook")
+	request.Header.Set(HeaderEvent, delivery.Event)
+	request.Header.Set(HeaderDelivery, delivery.ID)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	if subscriber.Secret != "" {
+		request.Header.Set(HeaderSignature, Sign(subscriber.Secret, timestamp, body))
+	}
+
+	response, err := d.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return response.StatusCode, fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+	return response.StatusCode, nil
+}
+
+// retryable reports whether a delivery that got statusCode is retried: network
+// errors, rate limiting and server errors are, other client errors are not.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// Sign returns the signature header value of body sent at timestamp. Receivers
+// compute the same value and compare it with hmac.Equal.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) log(delivery Delivery) {
+	if d.LogPath == "" {
+		return
+	}
+
+	line, err := json.Marshal(delivery)
+	if err == nil {
+		err = appendLine(d.LogPath, line)
+	}
+	if err != nil {
+		logger.ErrorLogger.Error("error writing the webhook delivery log", zap.String("path", d.LogPath), zap.String("error: ", err.Error()))
+	}
+}
+
+func appendLine(path string, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}